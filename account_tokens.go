@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	accountTokensBucket = "account-tokens"
+	accountTokensSeeded = "seeded"
+)
+
+// AccountToken is a token transferred by a watched account.
+type AccountToken struct {
+	// Token details at the time of the latest transfer.
+	Token        *token.Token
+	Transfers    int
+	LastTransfer time.Time
+	// Set once a legitimate transfer of the token is seen, see IsLegitimateTransfer.
+	Legitimate bool
+	// Set once a transfer of the token is flagged by the spam filter.
+	Suspicious bool
+}
+
+// Spam reports whether the token is known only from suspicious transfers.
+func (e *AccountToken) Spam() bool {
+	return e.Suspicious && !e.Legitimate
+}
+
+// AccountTokens persists tokens transferred per watched account,
+// so balances can be looked up without scanning the whole history.
+type AccountTokens interface {
+	Add(transfer *Transfer, t time.Time) error
+	// Returns tokens transferred by the account in no particular order.
+	List(account common.Address) ([]*AccountToken, error)
+}
+
+type accountTokens struct {
+	// Serializes read-modify-write in Add.
+	mu    sync.Mutex
+	store Store
+}
+
+// NewAccountTokens returns account tokens persisted in the store.
+// On first use they are seeded from the transfers in history.
+func NewAccountTokens(store Store, history History) AccountTokens {
+	a := &accountTokens{
+		store: store,
+	}
+	var seeded bool
+	if err := store.Get(accountTokensBucket, []byte(accountTokensSeeded), &seeded); err != nil {
+		if !errors.Is(err, leveldb.ErrNotFound) {
+			log.Printf("Failed to read account tokens: %v", err)
+		}
+		a.seed(history)
+	}
+	return a
+}
+
+func (a *accountTokens) seed(history History) {
+	var count int
+	err := history.ForEach(func(entry *HistoryEntry) (bool, error) {
+		count++
+		return true, a.Add(entry.Transfer, entry.Time)
+	})
+	if err == nil {
+		err = a.store.Put(accountTokensBucket, []byte(accountTokensSeeded), true)
+	}
+	if err != nil {
+		log.Printf("Failed to seed account tokens from history: %v", err)
+		return
+	}
+	log.Printf("Seeded account tokens from %d transfers in history", count)
+}
+
+func accountTokensBucketOf(account common.Address) string {
+	return accountTokensBucket + "/" + account.Hex()
+}
+
+func (a *accountTokens) Add(transfer *Transfer, t time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	bucket := accountTokensBucketOf(transfer.Account())
+	key := transfer.Token.Address.Bytes()
+	entry := &AccountToken{}
+	if err := a.store.Get(bucket, key, entry); err != nil {
+		if !errors.Is(err, leveldb.ErrNotFound) {
+			return err
+		}
+		entry = &AccountToken{}
+	}
+	entry.Token = transfer.Token
+	entry.Transfers++
+	if t.After(entry.LastTransfer) {
+		entry.LastTransfer = t
+	}
+	if IsLegitimateTransfer(transfer) {
+		entry.Legitimate = true
+	} else if len(transfer.Suspicious) > 0 {
+		entry.Suspicious = true
+	}
+	return a.store.Put(bucket, key, entry)
+}
+
+func (a *accountTokens) List(account common.Address) ([]*AccountToken, error) {
+	var entries []*AccountToken
+	err := a.store.ForEach(accountTokensBucketOf(account), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		entry := &AccountToken{}
+		if err := decode(entry); err != nil {
+			return false, err
+		}
+		entries = append(entries, entry)
+		return true, nil
+	})
+	return entries, err
+}
@@ -1,6 +1,12 @@
 package main
 
-import "github.com/ethereum/go-ethereum/common"
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
 
 type Accounts map[common.Address]string
 
@@ -21,3 +27,33 @@ func (a Accounts) Lookup(addr common.Address) string {
 	}
 	return alias
 }
+
+// Find returns the account address by its alias or address.
+func (a Accounts) Find(aliasOrAddress string) (common.Address, bool) {
+	if common.IsHexAddress(aliasOrAddress) {
+		addr := common.HexToAddress(aliasOrAddress)
+		_, has := a[addr]
+		return addr, has
+	}
+	for addr, alias := range a {
+		if strings.EqualFold(alias, aliasOrAddress) {
+			return addr, true
+		}
+	}
+	return common.Address{}, false
+}
+
+// Sorted returns account addresses ordered by alias, then by address.
+func (a Accounts) Sorted() []common.Address {
+	addrs := make([]common.Address, 0, len(a))
+	for addr := range a {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if a[addrs[i]] != a[addrs[j]] {
+			return a[addrs[i]] < a[addrs[j]]
+		}
+		return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0
+	})
+	return addrs
+}
@@ -1,26 +1,311 @@
 package main
 
 import (
+	"context"
+	"log"
+	"math/big"
+	"reflect"
+	"sync"
+
 	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 type App struct {
-	config        *Config
-	tokensDB      token.TokensDB
-	accounts      Accounts
-	telegram      Telegram
-	client        *ethclient.Client
-	tokensManager token.TokensManager
-}
-
-func NewApp(config *Config, tokensDB token.TokensDB, accounts Accounts, telegram Telegram, client *ethclient.Client, tokensManager token.TokensManager) *App {
-	return &App{
-		config:        config,
-		tokensDB:      tokensDB,
-		accounts:      accounts,
-		telegram:      telegram,
-		client:        client,
-		tokensManager: tokensManager,
+	tokensDB       token.TokensDB
+	store          Store
+	client         *ethclient.Client
+	tokensManager  token.TokensManager
+	history        History
+	counterparties Counterparties
+	accountTokens  AccountTokens
+	status         *SyncStatus
+
+	// Guards the parts of the app which can be swapped by a config reload.
+	mu        sync.RWMutex
+	config    *Config
+	accounts  Accounts
+	registry  *token.Registry
+	rules     *Rules
+	spam      *SpamFilter
+	valuation *Valuation
+	format    token.Format
+	templates *MessageTemplates
+	notifier  Notifier
+}
+
+// BotBackend provides read-only data for chat bot commands.
+type BotBackend interface {
+	Accounts() Accounts
+	History() History
+	Status(ctx context.Context) *StatusReport
+	Balances(ctx context.Context, addr common.Address) []*Balance
+	Portfolio(ctx context.Context, addr common.Address) *Portfolio
+	AmountFormat() token.Format
+}
+
+func NewApp(config *Config, tokensDB token.TokensDB, store Store, accounts Accounts, client *ethclient.Client, tokensManager token.TokensManager, history History, counterparties Counterparties, accountTokens AccountTokens) (app *App, err error) {
+	if app, err = NewReadOnlyApp(config, tokensDB, store, accounts, client, tokensManager, history, counterparties, accountTokens); err != nil {
+		return nil, err
+	}
+	if app.notifier, err = NewNotifier(config, store, app); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// NewReadOnlyApp returns the app without notifiers, for commands which only read balances and history.
+func NewReadOnlyApp(config *Config, tokensDB token.TokensDB, store Store, accounts Accounts, client *ethclient.Client, tokensManager token.TokensManager, history History, counterparties Counterparties, accountTokens AccountTokens) (app *App, err error) {
+	app = &App{
+		config:         config,
+		tokensDB:       tokensDB,
+		store:          store,
+		accounts:       accounts,
+		client:         client,
+		tokensManager:  tokensManager,
+		history:        history,
+		counterparties: counterparties,
+		accountTokens:  accountTokens,
+		status:         NewSyncStatus(),
+	}
+	if app.registry, err = NewTokenRegistry(config); err != nil {
+		return nil, err
+	}
+	tokensManager.SetRegistry(app.registry)
+	if app.rules, err = NewRules(config, app.registry); err != nil {
+		return nil, err
+	}
+	app.spam = NewSpamFilter(config, counterparties)
+	if app.valuation, err = NewValuation(config, client); err != nil {
+		return nil, err
+	}
+	if app.format, err = NewAmountFormat(config); err != nil {
+		return nil, err
+	}
+	if app.templates, err = NewMessageTemplates(config, nil, noEscape); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (app *App) Config() *Config {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.config
+}
+
+func (app *App) Accounts() Accounts {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.accounts
+}
+
+func (app *App) Rules() *Rules {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.rules
+}
+
+func (app *App) Spam() *SpamFilter {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.spam
+}
+
+// Valuation returns nil if prices are not configured.
+func (app *App) Valuation() *Valuation {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.valuation
+}
+
+// AmountFormat returns the format of token amounts in messages.
+func (app *App) AmountFormat() token.Format {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.format
+}
+
+// Templates returns templates for log messages and notifiers without own templates.
+func (app *App) Templates() *MessageTemplates {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.templates
+}
+
+func (app *App) Notifier() Notifier {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.notifier
+}
+
+func (app *App) History() History {
+	return app.history
+}
+
+type Balance struct {
+	Token *token.Token
+	Value *big.Int
+	Fiat  FiatValues
+	Err   error
+}
+
+// TrackedTokens returns ETH, tokens tracked by the config and all tokens each account has transferred.
+// Registered token details apply, blocklisted tokens and tokens known only from spam are left out.
+func (app *App) TrackedTokens(ctx context.Context) map[common.Address][]*token.Token {
+	resolved := make(map[common.Address]*token.Token)
+	resolve := func(addr common.Address) *token.Token {
+		t, has := resolved[addr]
+		if !has {
+			var err error
+			if t, err = app.tokensManager.GetToken(ctx, addr); err != nil && err != token.ErrBlocked {
+				log.Printf("Failed to get token %s: %v", addr.Hex(), err)
+			}
+			resolved[addr] = t
+		}
+		return t
+	}
+
+	tokens := make(map[common.Address][]*token.Token)
+	seen := make(map[common.Address]map[common.Address]bool)
+	add := func(account, tokenAddr common.Address) {
+		if seen[account] == nil || seen[account][tokenAddr] {
+			return
+		}
+		seen[account][tokenAddr] = true
+		if t := resolve(tokenAddr); t != nil {
+			tokens[account] = append(tokens[account], t)
+		}
+	}
+
+	tracked := trackedTokenAddresses(app.Config())
+	spam := app.Spam()
+	for addr := range app.Accounts() {
+		tokens[addr] = []*token.Token{token.ETHToken}
+		seen[addr] = map[common.Address]bool{token.ETHToken.Address: true}
+		for _, tokenAddr := range tracked {
+			add(addr, tokenAddr)
+		}
+		entries, err := app.accountTokens.List(addr)
+		if err != nil {
+			log.Printf("Failed to read tokens of %s: %v", app.Accounts().Lookup(addr), err)
+		}
+		for _, entry := range entries {
+			// Tokens airdropped by spammers are not worth balance lookups.
+			if entry.Spam() || spam.SuspiciousToken(entry.Token) {
+				continue
+			}
+			add(addr, entry.Token.Address)
+		}
 	}
+	return tokens
+}
+
+// Balances returns ETH balance and balances of all tokens the account has transferred.
+func (app *App) Balances(ctx context.Context, addr common.Address) []*Balance {
+	tokens := app.TrackedTokens(ctx)[addr]
+	if len(tokens) == 0 {
+		tokens = []*token.Token{token.ETHToken}
+	}
+
+	valuation := app.Valuation()
+	requests := make([]token.BalanceRequest, len(tokens))
+	for i, t := range tokens {
+		requests[i] = token.BalanceRequest{Token: t, Addr: addr}
+	}
+	balances := make([]*Balance, 0, len(tokens))
+	for i, r := range app.tokensManager.FetchBalances(ctx, requests, nil) {
+		balance := &Balance{Token: tokens[i], Value: r.Value, Err: r.Err}
+		if balance.Err == nil {
+			balance.Fiat = valuation.Values(ctx, balance.Token, balance.Value)
+		}
+		balances = append(balances, balance)
+	}
+	return balances
+}
+
+// Reload applies the given config to the running app.
+// Everything is prepared before the swap, so on error the current config stays in use.
+// Changed notifiers are the exception: the current ones are closed before the new ones start,
+// so e.g. Telegram updates are never polled twice, and restarted if the new ones fail.
+// The ETH node connection is not affected by reloads.
+func (app *App) Reload(config *Config) error {
+	current := app.Config()
+
+	if config.EthUrl != current.EthUrl {
+		log.Println("Config eth-url has changed, restart the app to apply it")
+		config.EthUrl = current.EthUrl
+	}
+
+	if httpListen(config) != httpListen(current) {
+		log.Println("Config http.listen has changed, restart the app to apply it")
+	}
+
+	accounts := NewAccounts(config)
+	app.mu.RLock()
+	registry := app.registry
+	app.mu.RUnlock()
+	registryChanged := !reflect.DeepEqual(config.Tokens, current.Tokens)
+	if registryChanged {
+		var err error
+		if registry, err = NewTokenRegistry(config); err != nil {
+			return err
+		}
+	}
+	rules, err := NewRules(config, registry)
+	if err != nil {
+		return err
+	}
+	spam := NewSpamFilter(config, app.counterparties)
+	valuation := app.Valuation()
+	if !reflect.DeepEqual(config.Prices, current.Prices) {
+		if valuation, err = NewValuation(config, app.client); err != nil {
+			return err
+		}
+	}
+	format, err := NewAmountFormat(config)
+	if err != nil {
+		return err
+	}
+	templates, err := NewMessageTemplates(config, nil, noEscape)
+	if err != nil {
+		return err
+	}
+
+	notifier := app.Notifier()
+	if !current.NotifiersEqual(config) {
+		// Pending deliveries are persisted, the new notifiers pick them up.
+		notifier.Close()
+		if notifier, err = NewNotifier(config, app.store, app); err != nil {
+			restored, restoreErr := NewNotifier(current, app.store, app)
+			if restoreErr != nil {
+				log.Printf("Failed to restart notifiers, notifications are only logged until the next reload: %v", restoreErr)
+				restored = NewDispatcher()
+			}
+			app.mu.Lock()
+			app.notifier = restored
+			app.mu.Unlock()
+			return err
+		}
+	}
+
+	app.mu.Lock()
+	app.config = config
+	app.accounts = accounts
+	app.registry = registry
+	app.rules = rules
+	app.spam = spam
+	app.valuation = valuation
+	app.format = format
+	app.templates = templates
+	app.notifier = notifier
+	app.mu.Unlock()
+
+	if registryChanged {
+		app.tokensManager.SetRegistry(registry)
+	}
+
+	log.Printf("Config reloaded, watching %d accounts", len(accounts))
+	return nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const usage = `Usage:
+  eth-listener [flags]                 start listening for transfers
+  eth-listener [flags] config check    validate the config file and exit
+  eth-listener [flags] portfolio [account...]
+                                       show non-zero balances of all tokens ever transferred
+                                       (reads the app databases, so the listener must be stopped)
+
+Every config field can be overridden by an environment variable, e.g. ETH_LISTENER_ETH_URL,
+ETH_LISTENER_TELEGRAM_TOKEN or ETH_LISTENER_ACCOUNTS_0_ADDRESS. Append _FILE to read the value from a file.
+
+Flags:
+`
+
+// Runs a CLI subcommand and exits, if any was given.
+func runCommand(args []string, configPath string) {
+	if len(args) == 0 {
+		return
+	}
+
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "check":
+		os.Exit(configCheckCommand(configPath))
+	case args[0] == "portfolio":
+		os.Exit(portfolioCommand(configPath, args[1:]))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func configCheckCommand(configPath string) int {
+	if _, err := LoadConfig(configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return 1
+	}
+	fmt.Printf("%s: OK\n", configPath)
+	return 0
+}
+
+func portfolioCommand(configPath string, args []string) int {
+	// Notifiers are not built, they would resume delivery queues and start bots.
+	app, err := WireReadOnlyApp(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer app.tokensDB.Close()
+	defer app.store.Close()
+
+	accounts := app.Accounts()
+	var addrs []common.Address
+	for _, arg := range args {
+		addr, ok := accounts.Find(arg)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown account: %s\n", arg)
+			return 1
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		addrs = accounts.Sorted()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PortfolioTimeout)
+	defer cancel()
+
+	format := app.AmountFormat()
+	for _, addr := range addrs {
+		fmt.Println(strings.Join(app.Portfolio(ctx, addr).Lines(accounts.Lookup(addr), format), "\n"))
+	}
+	return 0
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
-	"log"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
 
 type TelegramConfig struct {
-	Token    string `yaml:"token"`
+	Token string               `yaml:"token"`
+	Users []TelegramUserConfig `yaml:"users"`
+	// Either empty (plain text), "HTML" or "MarkdownV2", templates should use `escape` accordingly.
+	ParseMode string          `yaml:"parse-mode"`
+	Templates TemplatesConfig `yaml:"templates"`
+	Retry     RetryConfig     `yaml:"retry"`
+	// Deprecated: usernames can be changed by users, only kept to report a readable error.
 	Username string `yaml:"username"`
 }
 
@@ -18,11 +27,40 @@ type AccountConfig struct {
 }
 
 type Config struct {
-	EthUrl   string          `yaml:"eth-url"`
-	Accounts []AccountConfig `yaml:"accounts"`
-	Telegram *TelegramConfig `yaml:"telegram"`
+	EthUrl      string           `yaml:"eth-url"`
+	ExplorerUrl string           `yaml:"explorer-url"`
+	Accounts    []AccountConfig  `yaml:"accounts"`
+	Tokens      *TokensConfig    `yaml:"tokens"`
+	Rules       []RuleConfig     `yaml:"rules"`
+	Spam        *SpamConfig      `yaml:"spam"`
+	Prices      *PricesConfig    `yaml:"prices"`
+	Snapshots   *SnapshotsConfig `yaml:"snapshots"`
+	Templates   TemplatesConfig  `yaml:"templates"`
+	Format      *FormatConfig    `yaml:"format"`
+	HTTP        *HTTPConfig      `yaml:"http"`
+	Telegram    *TelegramConfig  `yaml:"telegram"`
+	Slack       *SlackConfig     `yaml:"slack"`
+	Discord     *DiscordConfig   `yaml:"discord"`
+	Email       *EmailConfig     `yaml:"email"`
+	Webhooks    []WebhookConfig  `yaml:"webhooks"`
 }
 
+// NotifiersEqual reports whether both configs have the same notifier settings.
+// Notifiers may refer to accounts, so account changes are taken into account too.
+func (c *Config) NotifiersEqual(other *Config) bool {
+	return c.ExplorerUrl == other.ExplorerUrl &&
+		reflect.DeepEqual(c.Accounts, other.Accounts) &&
+		reflect.DeepEqual(c.Templates, other.Templates) &&
+		reflect.DeepEqual(c.Format, other.Format) &&
+		reflect.DeepEqual(c.Telegram, other.Telegram) &&
+		reflect.DeepEqual(c.Slack, other.Slack) &&
+		reflect.DeepEqual(c.Discord, other.Discord) &&
+		reflect.DeepEqual(c.Email, other.Email) &&
+		reflect.DeepEqual(c.Webhooks, other.Webhooks)
+}
+
+// LoadConfig reads the config file, applies environment overrides and validates the result.
+// Validation problems are returned all at once as ConfigErrors.
 func LoadConfig(configPath string) (config *Config, err error) {
 	configData, err := ioutil.ReadFile(configPath)
 	if err != nil {
@@ -30,16 +68,19 @@ func LoadConfig(configPath string) (config *Config, err error) {
 	}
 
 	config = &Config{}
-	if err = yaml.Unmarshal(configData, config); err != nil {
-		return
+	decoder := yaml.NewDecoder(bytes.NewReader(configData))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
 	}
 
-	if len(config.Accounts) == 0 {
-		log.Fatalf("Config is missing accounts")
+	if err = applyEnvOverrides(config); err != nil {
+		return nil, err
 	}
-	if config.EthUrl == "" {
-		log.Fatalf("Config is missing eth-url")
+
+	if err = config.Validate(); err != nil {
+		return nil, err
 	}
 
-	return
+	return config, nil
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Overrides config fields from environment variables.
+//
+// Variable names are derived from yaml keys: EnvPrefix, then the key path upper-cased
+// with '-' replaced by '_', e.g. ETH_LISTENER_ETH_URL or ETH_LISTENER_TELEGRAM_TOKEN.
+// Slice items are addressed by index (ETH_LISTENER_ACCOUNTS_0_ADDRESS) and may be appended
+// in order only, slices of scalars also accept a comma-separated list.
+// Map entries can only be overridden if the key is present in the config file,
+// e.g. ETH_LISTENER_WEBHOOKS_0_HEADERS_AUTHORIZATION, since variable names lose the key case.
+// Appending the _FILE suffix reads the value from the given file instead,
+// which is meant for secrets mounted into containers.
+func applyEnvOverrides(config *Config) error {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.HasPrefix(kv, EnvPrefix) {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return envOverrides(env).apply(reflect.ValueOf(config).Elem(), strings.TrimSuffix(EnvPrefix, "_"))
+}
+
+type envOverrides map[string]string
+
+// Returns the value for the given variable name, resolving the _FILE indirection.
+func (env envOverrides) lookup(name string) (string, bool, error) {
+	if value, has := env[name]; has {
+		return value, true, nil
+	}
+	if path, has := env[name+"_FILE"]; has {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+func (env envOverrides) hasPrefix(prefix string) bool {
+	for name := range env {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (env envOverrides) apply(v reflect.Value, name string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if isEnvScalar(v.Type().Elem()) {
+			value, has, err := env.lookup(name)
+			if err != nil || !has {
+				return err
+			}
+			scalar := reflect.New(v.Type().Elem())
+			if err := setEnvScalar(scalar.Elem(), value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			v.Set(scalar)
+			return nil
+		}
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return env.unsupported(name)
+		}
+		if v.IsNil() {
+			if !env.hasPrefix(name + "_") {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return env.apply(v.Elem(), name)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" || field.PkgPath != "" {
+				continue
+			}
+			fieldName := name + "_" + envKey(key)
+			if err := env.apply(v.Field(i), fieldName); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		if isEnvScalar(v.Type().Elem()) {
+			value, has, err := env.lookup(name)
+			if err != nil {
+				return err
+			}
+			if !has {
+				if env.hasPrefix(name + "_") {
+					return fmt.Errorf("%s: set the whole list as comma-separated values instead of single items", name)
+				}
+				return nil
+			}
+			items := strings.Split(value, ",")
+			slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+			for i, item := range items {
+				if err := setEnvScalar(slice.Index(i), strings.TrimSpace(item)); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+		for _, index := range env.indexes(name) {
+			if index > v.Len() {
+				return fmt.Errorf("%s_%d: index out of range, the slice has %d item(s) and new items must be added in order", name, index, v.Len())
+			}
+			if index == v.Len() {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			if err := env.apply(v.Index(index), fmt.Sprintf("%s_%d", name, index)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || !isEnvScalar(v.Type().Elem()) {
+			return env.unsupported(name)
+		}
+		if _, has, _ := env.lookup(name); has {
+			return fmt.Errorf("%s: maps can't be set as a whole, override their entries with %s_<KEY>", name, name)
+		}
+		keys := make(map[string]reflect.Value)
+		for _, key := range v.MapKeys() {
+			keys[name+"_"+envKey(key.String())] = key
+		}
+		for variable := range env {
+			if !strings.HasPrefix(variable, name+"_") {
+				continue
+			}
+			if _, has := keys[strings.TrimSuffix(variable, "_FILE")]; !has {
+				if _, has := keys[variable]; !has {
+					return fmt.Errorf("%s: no such key in the config file, only present map entries can be overridden", variable)
+				}
+			}
+		}
+		for variable, key := range keys {
+			value, has, err := env.lookup(variable)
+			if err != nil {
+				return err
+			}
+			if !has {
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setEnvScalar(elem, value); err != nil {
+				return fmt.Errorf("%s: %w", variable, err)
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+
+	default:
+		if !isEnvScalar(v.Type()) {
+			return env.unsupported(name)
+		}
+		value, has, err := env.lookup(name)
+		if err != nil || !has {
+			return err
+		}
+		if err := setEnvScalar(v, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+// Fails if any variable refers to a field that can't be set from the environment.
+func (env envOverrides) unsupported(name string) error {
+	if _, has, _ := env.lookup(name); has || env.hasPrefix(name+"_") {
+		return fmt.Errorf("%s: the field can't be set from environment variables", name)
+	}
+	return nil
+}
+
+// Returns the variable name part of a yaml key or map key.
+func envKey(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// Returns sorted slice indexes referenced by variables like <name>_<index>_...
+func (env envOverrides) indexes(name string) []int {
+	seen := make(map[int]bool)
+	for key := range env {
+		rest := strings.TrimPrefix(key, name+"_")
+		if rest == key {
+			continue
+		}
+		if i := strings.IndexByte(rest, '_'); i > 0 {
+			rest = rest[:i]
+		}
+		if index, err := strconv.Atoi(rest); err == nil && index >= 0 {
+			seen[index] = true
+		}
+	}
+	indexes := make([]int, 0, len(seen))
+	for index := range seen {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func isEnvScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func setEnvScalar(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func applyTestEnv(config *Config, env map[string]string) error {
+	return envOverrides(env).apply(reflect.ValueOf(config).Elem(), "ETH_LISTENER")
+}
+
+func TestEnvOverrides(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("Bearer abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		Accounts: []AccountConfig{{Address: "0x01", Alias: "Old"}},
+		Webhooks: []WebhookConfig{{Url: "https://example.com", Headers: map[string]string{"Authorization": "", "X-Api-Key": "key"}}},
+	}
+	err := applyTestEnv(config, map[string]string{
+		"ETH_LISTENER_ETH_URL":                               "wss://node",
+		"ETH_LISTENER_ACCOUNTS_0_ALIAS":                      "New",
+		"ETH_LISTENER_ACCOUNTS_1_ADDRESS":                    "0x02",
+		"ETH_LISTENER_FORMAT_PRECISION":                      "0",
+		"ETH_LISTENER_PRICES_CURRENCIES":                     "USD, EUR",
+		"ETH_LISTENER_WEBHOOKS_0_HEADERS_AUTHORIZATION_FILE": secret,
+		"ETH_LISTENER_WEBHOOKS_0_HEADERS_X_API_KEY":          "other",
+		"ETH_LISTENER_WEBHOOKS_0_RETRY_MAX_ATTEMPTS":         "3",
+		"ETH_LISTENER_TELEGRAM_RETRY_INITIAL_BACKOFF":        "2s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.EthUrl != "wss://node" {
+		t.Errorf("eth-url = %q", config.EthUrl)
+	}
+	if want := []AccountConfig{{Address: "0x01", Alias: "New"}, {Address: "0x02"}}; !reflect.DeepEqual(config.Accounts, want) {
+		t.Errorf("accounts = %+v", config.Accounts)
+	}
+	if config.Format == nil || config.Format.Precision == nil || *config.Format.Precision != 0 {
+		t.Errorf("format = %+v", config.Format)
+	}
+	if config.Prices == nil || !reflect.DeepEqual(config.Prices.Currencies, []string{"USD", "EUR"}) {
+		t.Errorf("prices = %+v", config.Prices)
+	}
+	if want := map[string]string{"Authorization": "Bearer abc", "X-Api-Key": "other"}; !reflect.DeepEqual(config.Webhooks[0].Headers, want) {
+		t.Errorf("headers = %v", config.Webhooks[0].Headers)
+	}
+	if config.Webhooks[0].Retry.MaxAttempts != 3 {
+		t.Errorf("retry = %+v", config.Webhooks[0].Retry)
+	}
+	if config.Telegram == nil || config.Telegram.Retry.InitialBackoff.Seconds() != 2 {
+		t.Errorf("telegram = %+v", config.Telegram)
+	}
+}
+
+func TestEnvOverridesErrors(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"ETH_LISTENER_ACCOUNTS_2_ADDRESS": "0x03"}, "ETH_LISTENER_ACCOUNTS_2: index out of range"},
+		{map[string]string{"ETH_LISTENER_WEBHOOKS_0_HEADERS_X_OTHER": "value"}, "ETH_LISTENER_WEBHOOKS_0_HEADERS_X_OTHER: no such key"},
+		{map[string]string{"ETH_LISTENER_WEBHOOKS_0_HEADERS": "a=b"}, "maps can't be set as a whole"},
+		{map[string]string{"ETH_LISTENER_PRICES_CURRENCIES_0": "USD"}, "comma-separated"},
+		{map[string]string{"ETH_LISTENER_FORMAT_PRECISION": "two"}, "ETH_LISTENER_FORMAT_PRECISION: "},
+	}
+	for _, tt := range tests {
+		config := &Config{
+			Accounts: []AccountConfig{{Address: "0x01"}},
+			Webhooks: []WebhookConfig{{Url: "https://example.com", Headers: map[string]string{"Authorization": ""}}},
+		}
+		if err := applyTestEnv(config, tt.env); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: got error %v, want %q", tt.env, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/andrei-toptal/eth-listener/price"
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var telegramTokenRegexp = regexp.MustCompile(`^\d+:[\w-]+$`)
+
+// ConfigError describes a single problem with a config field.
+type ConfigError struct {
+	Field   string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ConfigErrors collects all problems found during config validation.
+type ConfigErrors []*ConfigError
+
+func (errs ConfigErrors) Error() string {
+	lines := make([]string, 0, len(errs)+1)
+	lines = append(lines, fmt.Sprintf("config has %d problem(s):", len(errs)))
+	for _, err := range errs {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs *ConfigErrors) add(field, format string, args ...interface{}) {
+	*errs = append(*errs, &ConfigError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the whole config and returns ConfigErrors with every problem found, or nil.
+func (c *Config) Validate() error {
+	var errs ConfigErrors
+
+	c.validateEthUrl(&errs)
+	c.validateAccounts(&errs)
+	c.validateExplorerUrl(&errs)
+	c.validateTokens(&errs)
+	c.validateRules(&errs)
+	c.validateSpam(&errs)
+	c.validatePrices(&errs)
+	c.validateSnapshots(&errs)
+	c.validateTemplates(&errs, "templates", c.Templates)
+	c.validateFormat(&errs)
+	c.validateHTTP(&errs)
+	c.validateTelegram(&errs)
+	c.validateSlack(&errs)
+	c.validateDiscord(&errs)
+	c.validateEmail(&errs)
+	c.validateWebhooks(&errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) validateEthUrl(errs *ConfigErrors) {
+	if c.EthUrl == "" {
+		errs.add("eth-url", "is required")
+		return
+	}
+	u, err := url.Parse(c.EthUrl)
+	if err != nil {
+		errs.add("eth-url", "is not a valid URL: %v", err)
+		return
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		if u.Host == "" {
+			errs.add("eth-url", "is missing a host")
+		}
+	case "http", "https":
+		errs.add("eth-url", "scheme %q does not support subscriptions, use ws:// or wss://", u.Scheme)
+	case "":
+		if !strings.HasSuffix(u.Path, ".ipc") {
+			errs.add("eth-url", "must be a ws:// or wss:// URL or a path to an .ipc file")
+		}
+	default:
+		errs.add("eth-url", "unsupported scheme %q, use ws:// or wss://", u.Scheme)
+	}
+}
+
+func (c *Config) validateAccounts(errs *ConfigErrors) {
+	if len(c.Accounts) == 0 {
+		errs.add("accounts", "at least one account is required")
+		return
+	}
+
+	addresses := make(map[common.Address]int)
+	aliases := make(map[string]int)
+	for i, acc := range c.Accounts {
+		field := fmt.Sprintf("accounts[%d]", i)
+
+		if err := validateAddress(acc.Address); err != nil {
+			errs.add(field+".address", "%v", err)
+		} else {
+			addr := common.HexToAddress(acc.Address)
+			if j, has := addresses[addr]; has {
+				errs.add(field+".address", "duplicates accounts[%d].address %s", j, addr)
+			} else {
+				addresses[addr] = i
+			}
+		}
+
+		if acc.Alias != "" {
+			if j, has := aliases[acc.Alias]; has {
+				errs.add(field+".alias", "duplicates accounts[%d].alias %q", j, acc.Alias)
+			} else {
+				aliases[acc.Alias] = i
+			}
+		}
+	}
+}
+
+// Checks the address format and, for mixed-case addresses, the EIP-55 checksum.
+func validateAddress(address string) error {
+	if address == "" {
+		return fmt.Errorf("is required")
+	}
+	if !strings.HasPrefix(address, "0x") {
+		return fmt.Errorf("%q must start with 0x", address)
+	}
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("%q is not a valid address, expected 0x followed by 40 hex characters", address)
+	}
+	hex := address[2:]
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) {
+		if checksummed := common.HexToAddress(address).Hex(); checksummed != address {
+			return fmt.Errorf("%q has an invalid EIP-55 checksum, did you mean %s?", address, checksummed)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateTelegram(errs *ConfigErrors) {
+	if c.Telegram == nil {
+		return
+	}
+	if c.Telegram.Token == "" {
+		errs.add("telegram.token", "is required")
+	} else if !telegramTokenRegexp.MatchString(c.Telegram.Token) {
+		errs.add("telegram.token", "is not a valid bot token, expected <bot-id>:<secret> as issued by @BotFather")
+	}
+	if c.Telegram.Username != "" {
+		errs.add("telegram.username", "is no longer supported, list numeric user IDs in telegram.users instead")
+	}
+	users := make(map[int64]int)
+	for i, user := range c.Telegram.Users {
+		field := fmt.Sprintf("telegram.users[%d]", i)
+		if user.ID <= 0 {
+			errs.add(field+".id", "%d is not a valid Telegram user ID", user.ID)
+		} else if j, has := users[user.ID]; has {
+			errs.add(field+".id", "duplicates telegram.users[%d].id", j)
+		} else {
+			users[user.ID] = i
+		}
+		if user.Role != TelegramRoleAdmin && user.Role != TelegramRoleViewer {
+			errs.add(field+".role", "must be %q or %q", TelegramRoleAdmin, TelegramRoleViewer)
+		}
+	}
+	switch c.Telegram.ParseMode {
+	case "", tgbotapi.ModeHTML, tgbotapi.ModeMarkdownV2:
+	default:
+		errs.add("telegram.parse-mode", "must be empty, %q or %q", tgbotapi.ModeHTML, tgbotapi.ModeMarkdownV2)
+	}
+	c.validateTemplates(errs, "telegram.templates", c.Telegram.Templates)
+	validateRetry(errs, "telegram.retry", c.Telegram.Retry)
+}
+
+func (c *Config) validateTemplates(errs *ConfigErrors, field string, templates TemplatesConfig) {
+	kinds := make([]string, 0, len(templates))
+	for kind := range templates {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+
+	for _, k := range kinds {
+		kind, text := EventKind(k), templates[EventKind(k)]
+		known := false
+		for _, templateKind := range templateEventKinds {
+			known = known || templateKind == kind
+		}
+		if !known {
+			errs.add(field, "unknown event kind %q", kind)
+			continue
+		}
+		if _, err := NewMessageTemplates(&Config{}, TemplatesConfig{kind: text}, noEscape); err != nil {
+			errs.add(fmt.Sprintf("%s.%s", field, kind), "%v", err)
+		}
+	}
+}
+
+func (c *Config) validateRules(errs *ConfigErrors) {
+	accounts := NewAccounts(c)
+	// Token list errors are reported by validateTokens.
+	registry, err := NewTokenRegistry(c)
+	if err != nil {
+		registry = token.NewRegistry()
+	}
+	symbols := newTokenSymbols(c, registry)
+	for i, rc := range c.Rules {
+		if _, err := newRule(rc, accounts, symbols); err != nil {
+			errs.add(fmt.Sprintf("rules[%d]", i), "%v", err)
+		}
+		if len(rc.MinFiat) > 0 && (c.Prices == nil || len(c.Prices.Sources) == 0) {
+			errs.add(fmt.Sprintf("rules[%d].min-fiat", i), "needs prices.sources to be configured")
+			continue
+		}
+		currencies := c.priceCurrencies()
+		for currency := range rc.MinFiat {
+			if !currencies[strings.ToUpper(currency)] {
+				errs.add(fmt.Sprintf("rules[%d].min-fiat.%s", i, currency), "is not one of prices.currencies, values in it are never known")
+			}
+		}
+	}
+}
+
+// Returns upper-cased currencies prices are fetched in.
+func (c *Config) priceCurrencies() map[string]bool {
+	currencies := map[string]bool{DefaultFiatCurrency: true}
+	if c.Prices != nil && len(c.Prices.Currencies) > 0 {
+		currencies = make(map[string]bool)
+		for _, currency := range c.Prices.Currencies {
+			currencies[strings.ToUpper(currency)] = true
+		}
+	}
+	return currencies
+}
+
+func (c *Config) validateSpam(errs *ConfigErrors) {
+	if c.Spam == nil {
+		return
+	}
+	switch c.Spam.Action {
+	case "", SpamActionMark, SpamActionSuppress, SpamActionOff:
+	default:
+		errs.add("spam.action", "unknown action %q, use %s, %s or %s", c.Spam.Action, SpamActionMark, SpamActionSuppress, SpamActionOff)
+	}
+	for i, addr := range c.Spam.AllowTokens {
+		if err := validateAddress(addr); err != nil {
+			errs.add(fmt.Sprintf("spam.allow-tokens[%d]", i), "%v", err)
+		}
+	}
+	if c.Spam.LookalikeChars < 0 || c.Spam.LookalikeChars > MaxLookalikeChars {
+		errs.add("spam.lookalike-chars", "must be between 1 and %d hex characters, or 0 for the default of %d", MaxLookalikeChars, DefaultLookalikeChars)
+	}
+	for symbol, addr := range c.Spam.KnownTokens {
+		if normalizeSymbol(symbol) == "" {
+			errs.add("spam.known-tokens", "%q is not a token symbol", symbol)
+		}
+		if err := validateAddress(addr); err != nil {
+			errs.add("spam.known-tokens."+symbol, "%v", err)
+		}
+	}
+}
+
+func (c *Config) validatePrices(errs *ConfigErrors) {
+	if c.Prices == nil {
+		return
+	}
+	for i, currency := range c.Prices.Currencies {
+		if len(currency) != 3 {
+			errs.add(fmt.Sprintf("prices.currencies[%d]", i), "%q is not a currency code like USD", currency)
+		}
+	}
+	for i, sc := range c.Prices.Sources {
+		field := fmt.Sprintf("prices.sources[%d]", i)
+		switch sc.Type {
+		case PriceSourceStatic:
+			if sc.File == "" {
+				errs.add(field+".file", "is required")
+			} else if _, err := price.NewStaticFile(sc.File); err != nil {
+				errs.add(field+".file", "%v", err)
+			}
+		case PriceSourceHTTP:
+			if sc.Url != "" {
+				if err := validateHttpUrl(sc.Url); err != nil {
+					errs.add(field+".url", "%v", err)
+				}
+			}
+			if sc.ApiKey != "" && sc.ApiKeyHeader == "" {
+				errs.add(field+".api-key-header", "is required when api-key is set")
+			}
+			if sc.CacheTTL < 0 {
+				errs.add(field+".cache-ttl", "must not be negative")
+			}
+		case PriceSourceOnChain:
+			if len(sc.Feeds) == 0 {
+				errs.add(field+".feeds", "at least one feed is required")
+			}
+			for j, fc := range sc.Feeds {
+				if _, err := parsePriceFeed(fc); err != nil {
+					errs.add(fmt.Sprintf("%s.feeds[%d]", field, j), "%v", err)
+				}
+			}
+		default:
+			errs.add(field+".type", "unknown type %q, use %s, %s or %s", sc.Type, PriceSourceStatic, PriceSourceHTTP, PriceSourceOnChain)
+		}
+	}
+}
+
+func (c *Config) validateFormat(errs *ConfigErrors) {
+	if c.Format == nil {
+		return
+	}
+	if c.Format.Locale != "" {
+		if _, err := token.LocaleFormat(c.Format.Locale); err != nil {
+			errs.add("format.locale", "%v", err)
+		}
+	}
+	if c.Format.Precision != nil && *c.Format.Precision < 0 {
+		errs.add("format.precision", "must not be negative")
+	}
+}
+
+func (c *Config) validateTokens(errs *ConfigErrors) {
+	if c.Tokens == nil {
+		return
+	}
+	for i, path := range c.Tokens.Lists {
+		if _, err := token.LoadTokenList(path, c.Tokens.chainId()); err != nil {
+			errs.add(fmt.Sprintf("tokens.lists[%d]", i), "%v", err)
+		}
+	}
+
+	blocked := make(map[common.Address]bool)
+	for i, addr := range c.Tokens.Blocklist {
+		field := fmt.Sprintf("tokens.blocklist[%d]", i)
+		if err := validateAddress(addr); err != nil {
+			errs.add(field, "%v", err)
+			continue
+		}
+		blocked[common.HexToAddress(addr)] = true
+	}
+
+	seen := make(map[common.Address]int)
+	for i, tc := range c.Tokens.Tracked {
+		field := fmt.Sprintf("tokens.tracked[%d]", i)
+		if err := validateAddress(tc.Address); err != nil {
+			errs.add(field+".address", "%v", err)
+			continue
+		}
+		addr := common.HexToAddress(tc.Address)
+		if addr == token.ETHToken.Address {
+			errs.add(field+".address", "ETH is always tracked")
+		}
+		if j, has := seen[addr]; has {
+			errs.add(field+".address", "duplicates tokens.tracked[%d]", j)
+		}
+		seen[addr] = i
+		if blocked[addr] {
+			errs.add(field+".address", "is blocklisted")
+		}
+	}
+}
+
+func (c *Config) validateHTTP(errs *ConfigErrors) {
+	if c.HTTP == nil {
+		return
+	}
+	if c.HTTP.Listen == "" {
+		errs.add("http.listen", "is required")
+	} else if host, port, err := net.SplitHostPort(c.HTTP.Listen); err != nil || port == "" {
+		errs.add("http.listen", "must be a host:port address, e.g. 127.0.0.1:8080")
+	} else if c.HTTP.Token == "" && !isLoopbackHost(host) {
+		errs.add("http.token", "is required unless listening on a loopback address")
+	}
+}
+
+// Reports whether host is localhost or a loopback IP, an empty host means all interfaces.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *Config) validateSnapshots(errs *ConfigErrors) {
+	if c.Snapshots == nil {
+		return
+	}
+	if c.Snapshots.Interval == 0 {
+		errs.add("snapshots.interval", "is required")
+	}
+	if c.Snapshots.GasTolerance != "" {
+		if _, err := token.ParseAmount(c.Snapshots.GasTolerance, int(token.ETHToken.Decimals)); err != nil {
+			errs.add("snapshots.gas-tolerance", "%v", err)
+		}
+	}
+	accounts := NewAccounts(c)
+	for i, lc := range c.Snapshots.LowBalance {
+		if _, err := newLowBalance(lc, accounts); err != nil {
+			errs.add(fmt.Sprintf("snapshots.low-balance[%d]", i), "%v", err)
+		}
+	}
+}
+
+func (c *Config) validateExplorerUrl(errs *ConfigErrors) {
+	if c.ExplorerUrl == "" {
+		return
+	}
+	if err := validateHttpUrl(c.ExplorerUrl); err != nil {
+		errs.add("explorer-url", "%v", err)
+	}
+}
+
+func (c *Config) validateSlack(errs *ConfigErrors) {
+	if c.Slack == nil {
+		return
+	}
+	if c.Slack.WebhookUrl == "" {
+		errs.add("slack.webhook-url", "is required")
+	} else if err := validateHttpUrl(c.Slack.WebhookUrl); err != nil {
+		errs.add("slack.webhook-url", "%v", err)
+	}
+	c.validateTemplates(errs, "slack.templates", c.Slack.Templates)
+	validateRetry(errs, "slack.retry", c.Slack.Retry)
+}
+
+func (c *Config) validateDiscord(errs *ConfigErrors) {
+	if c.Discord == nil {
+		return
+	}
+	if c.Discord.WebhookUrl == "" {
+		errs.add("discord.webhook-url", "is required")
+	} else if err := validateHttpUrl(c.Discord.WebhookUrl); err != nil {
+		errs.add("discord.webhook-url", "%v", err)
+	}
+	c.validateTemplates(errs, "discord.templates", c.Discord.Templates)
+	validateRetry(errs, "discord.retry", c.Discord.Retry)
+}
+
+func (c *Config) validateEmail(errs *ConfigErrors) {
+	if c.Email == nil {
+		return
+	}
+	if c.Email.Host == "" {
+		errs.add("email.host", "is required")
+	}
+	if c.Email.Port < 0 || c.Email.Port > 65535 {
+		errs.add("email.port", "%d is not a valid port", c.Email.Port)
+	}
+	if c.Email.Username != "" && c.Email.Password == "" {
+		errs.add("email.password", "is required when username is set")
+	}
+	if c.Email.From == "" {
+		errs.add("email.from", "is required")
+	} else if _, err := mail.ParseAddress(c.Email.From); err != nil {
+		errs.add("email.from", "%q is not a valid email address", c.Email.From)
+	}
+	if len(c.Email.To) == 0 {
+		errs.add("email.to", "at least one recipient is required")
+	}
+	for i, to := range c.Email.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			errs.add(fmt.Sprintf("email.to[%d]", i), "%q is not a valid email address", to)
+		}
+	}
+	switch c.Email.Mode {
+	case "", EmailModeImmediate, EmailModeDigest:
+	default:
+		errs.add("email.mode", "must be %q or %q", EmailModeImmediate, EmailModeDigest)
+	}
+	switch c.Email.Digest {
+	case "", EmailDigestHourly, EmailDigestDaily:
+	default:
+		errs.add("email.digest", "must be %q or %q", EmailDigestHourly, EmailDigestDaily)
+	}
+	c.validateAccountRefs(errs, "email.accounts", c.Email.Accounts)
+	c.validateTemplates(errs, "email.templates", c.Email.Templates)
+	validateRetry(errs, "email.retry", c.Email.Retry)
+}
+
+// Checks that every reference matches an alias or an address from the accounts section.
+func (c *Config) validateAccountRefs(errs *ConfigErrors, field string, refs []string) {
+	accounts := NewAccounts(c)
+	for i, ref := range refs {
+		if _, ok := accounts.Find(ref); !ok {
+			errs.add(fmt.Sprintf("%s[%d]", field, i), "%q does not match any account alias or address", ref)
+		}
+	}
+}
+
+func (c *Config) validateWebhooks(errs *ConfigErrors) {
+	urls := make(map[string]int)
+	names := make(map[string]int)
+	for i, webhook := range c.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+
+		if webhook.Name != "" {
+			if j, has := names[webhook.Name]; has {
+				errs.add(field+".name", "duplicates webhooks[%d].name", j)
+			} else {
+				names[webhook.Name] = i
+			}
+		}
+
+		if webhook.Url == "" {
+			errs.add(field+".url", "is required")
+		} else if err := validateHttpUrl(webhook.Url); err != nil {
+			errs.add(field+".url", "%v", err)
+		} else if j, has := urls[webhook.Url]; has {
+			errs.add(field+".url", "duplicates webhooks[%d].url", j)
+		} else {
+			urls[webhook.Url] = i
+		}
+		if webhook.SignatureHeader != "" && webhook.Secret == "" {
+			errs.add(field+".signature-header", "is set but secret is empty")
+		}
+		if webhook.Timeout < 0 {
+			errs.add(field+".timeout", "must not be negative")
+		}
+		validateRetry(errs, field+".retry", webhook.Retry)
+	}
+}
+
+func validateHttpUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q, use http:// or https://", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("is missing a host")
+	}
+	return nil
+}
+
+func validateRetry(errs *ConfigErrors, field string, retry RetryConfig) {
+	if retry.MaxAttempts < 0 {
+		errs.add(field+".max-attempts", "must not be negative")
+	}
+	if retry.InitialBackoff < 0 {
+		errs.add(field+".initial-backoff", "must not be negative")
+	}
+	if retry.MaxBackoff < 0 {
+		errs.add(field+".max-backoff", "must not be negative")
+	}
+	if retry.InitialBackoff > 0 && retry.MaxBackoff > 0 && retry.InitialBackoff > retry.MaxBackoff {
+		errs.add(field+".initial-backoff", "must not exceed max-backoff")
+	}
+}
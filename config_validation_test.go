@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		err     string
+	}{
+		{"0xdAC17F958D2ee523a2206206994597C13D831ec7", ""},
+		{"0xdac17f958d2ee523a2206206994597c13d831ec7", ""},
+		{"0xDAC17F958D2EE523A2206206994597C13D831EC7", ""},
+		{"", "is required"},
+		{"0XdAC17F958D2ee523a2206206994597C13D831ec7", "must start with 0x"},
+		{"dAC17F958D2ee523a2206206994597C13D831ec7", "must start with 0x"},
+		{"0xdAC17F958D2ee523a2206206994597C13D831e", "not a valid address"},
+		{"0xdAC17F958D2ee523a2206206994597C13D831eZ7", "not a valid address"},
+		{"0xDAC17F958D2ee523a2206206994597C13D831ec7", "invalid EIP-55 checksum"},
+	}
+	for _, tt := range tests {
+		err := validateAddress(tt.address)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("validateAddress(%q) = %v", tt.address, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("validateAddress(%q) = %v, want %q", tt.address, err, tt.err)
+		}
+	}
+}
+
+func TestValidateSpamLookalikeChars(t *testing.T) {
+	for chars, valid := range map[int]bool{-1: false, 0: true, 4: true, 40: true, 41: false} {
+		var errs ConfigErrors
+		(&Config{Spam: &SpamConfig{LookalikeChars: chars}}).validateSpam(&errs)
+		if valid && len(errs) > 0 {
+			t.Errorf("lookalike-chars %d: %v", chars, errs)
+		}
+		if !valid && (len(errs) != 1 || !strings.Contains(errs.Error(), "hex characters")) {
+			t.Errorf("lookalike-chars %d: got %v", chars, errs)
+		}
+	}
+}
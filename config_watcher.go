@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Reloads config on SIGHUP or whenever the config file modification time changes.
+func watchConfig(ctx context.Context, configPath string, app *App) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	ticker := time.NewTicker(ConfigPollInterval)
+	defer ticker.Stop()
+
+	lastModTime := configModTime(configPath)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupCh:
+			log.Println("Received SIGHUP, reloading config...")
+			lastModTime = configModTime(configPath)
+			reloadConfig(configPath, app)
+		case <-ticker.C:
+			modTime := configModTime(configPath)
+			if modTime.IsZero() || modTime.Equal(lastModTime) {
+				continue
+			}
+			lastModTime = modTime
+			log.Println("Config file has changed, reloading config...")
+			reloadConfig(configPath, app)
+		}
+	}
+}
+
+func reloadConfig(configPath string, app *App) {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		log.Printf("Failed to reload config, keeping the current one: %v", err)
+		return
+	}
+	if err := app.Reload(config); err != nil {
+		log.Printf("Failed to apply config, keeping the current one: %v", err)
+	}
+}
+
+func configModTime(configPath string) time.Time {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	counterpartiesBucket = "counterparties"
+	counterpartiesSeeded = "seeded"
+)
+
+// CounterpartyEntry is a legitimate counterparty of a watched account.
+type CounterpartyEntry struct {
+	Address   common.Address
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Transfers int
+}
+
+// Counterparties persists legitimate counterparties per watched account,
+// used to detect address poisoning with lookalike addresses.
+type Counterparties interface {
+	Add(account, counterparty common.Address, t time.Time) error
+	Get(account, counterparty common.Address) (*CounterpartyEntry, error)
+	// Returns a counterparty of the account which shares the first and last chars hex characters
+	// with addr but is a different address, nil if there is none.
+	Lookalike(account, addr common.Address, chars int) (*CounterpartyEntry, error)
+}
+
+type counterparties struct {
+	// Serializes read-modify-write in Add.
+	mu    sync.Mutex
+	store Store
+}
+
+// NewCounterparties returns counterparties persisted in the store.
+// On first use they are seeded from the non-suspicious transfers in history.
+func NewCounterparties(store Store, history History) Counterparties {
+	c := &counterparties{
+		store: store,
+	}
+	var seeded bool
+	if err := store.Get(counterpartiesBucket, []byte(counterpartiesSeeded), &seeded); err != nil {
+		if !errors.Is(err, leveldb.ErrNotFound) {
+			log.Printf("Failed to read counterparties: %v", err)
+		}
+		c.seed(history)
+	}
+	return c
+}
+
+func (c *counterparties) seed(history History) {
+	var count int
+	err := history.ForEach(func(entry *HistoryEntry) (bool, error) {
+		if !IsLegitimateTransfer(entry.Transfer) {
+			return true, nil
+		}
+		count++
+		return true, c.Add(entry.Transfer.Account(), entry.Transfer.Counterparty(), entry.Time)
+	})
+	if err == nil {
+		err = c.store.Put(counterpartiesBucket, []byte(counterpartiesSeeded), true)
+	}
+	if err != nil {
+		log.Printf("Failed to seed counterparties from history: %v", err)
+		return
+	}
+	log.Printf("Seeded counterparties from %d transfers in history", count)
+}
+
+// IsLegitimateTransfer reports whether the transfer counterparty can be trusted,
+// i.e. the transfer is not suspicious and moved some value.
+func IsLegitimateTransfer(transfer *Transfer) bool {
+	return len(transfer.Suspicious) == 0 && transfer.Value.Sign() > 0
+}
+
+func accountBucket(account common.Address) string {
+	return counterpartiesBucket + "/" + account.Hex()
+}
+
+func (c *counterparties) Add(account, counterparty common.Address, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, err := c.Get(account, counterparty)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry = &CounterpartyEntry{
+			Address:   counterparty,
+			FirstSeen: t,
+		}
+	}
+	if t.After(entry.LastSeen) {
+		entry.LastSeen = t
+	}
+	entry.Transfers++
+	return c.store.Put(accountBucket(account), counterparty.Bytes(), entry)
+}
+
+func (c *counterparties) Get(account, counterparty common.Address) (*CounterpartyEntry, error) {
+	entry := &CounterpartyEntry{}
+	err := c.store.Get(accountBucket(account), counterparty.Bytes(), entry)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (c *counterparties) Lookalike(account, addr common.Address, chars int) (*CounterpartyEntry, error) {
+	var found *CounterpartyEntry
+	err := c.store.ForEach(accountBucket(account), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		if !lookalike(addr, common.BytesToAddress(key), chars) {
+			return true, nil
+		}
+		found = &CounterpartyEntry{}
+		return false, decode(found)
+	})
+	return found, err
+}
+
+// Returns true if both addresses share the leading and trailing chars hex characters but differ.
+func lookalike(a, b common.Address, chars int) bool {
+	if a == b {
+		return false
+	}
+	ha, hb := strings.ToLower(a.Hex()[2:]), strings.ToLower(b.Hex()[2:])
+	return ha[:chars] == hb[:chars] && ha[len(ha)-chars:] == hb[len(hb)-chars:]
+}
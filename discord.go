@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	discordColorSent     = 0xe74c3c
+	discordColorReceived = 0x2ecc71
+	discordColorWarning  = 0xf1c40f
+)
+
+type DiscordConfig struct {
+	// Channel webhook URL, see https://support.discord.com/hc/en-us/articles/228383668
+	WebhookUrl string `yaml:"webhook-url"`
+	// Overrides the webhook's default username.
+	Username  string          `yaml:"username"`
+	Templates TemplatesConfig `yaml:"templates"`
+	Retry     RetryConfig     `yaml:"retry"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+type discordEmbed struct {
+	Title       string               `json:"title"`
+	Description string               `json:"description,omitempty"`
+	Url         string               `json:"url,omitempty"`
+	Color       int                  `json:"color"`
+	Timestamp   string               `json:"timestamp,omitempty"`
+	Fields      []*discordEmbedField `json:"fields,omitempty"`
+	Footer      *discordEmbedFooter  `json:"footer,omitempty"`
+}
+
+type discordMessage struct {
+	Username string          `json:"username,omitempty"`
+	Content  string          `json:"content,omitempty"`
+	Embeds   []*discordEmbed `json:"embeds,omitempty"`
+}
+
+type discord struct {
+	config    *DiscordConfig
+	explorer  Explorer
+	templates *MessageTemplates
+	client    *http.Client
+	queue     *deliveryQueue
+}
+
+// Returns nil notifier if Discord is not configured.
+func NewDiscord(config *Config, store Store) (Notifier, error) {
+	if config.Discord == nil {
+		return nil, nil
+	}
+	templates, err := NewMessageTemplates(config, config.Discord.Templates, noEscape)
+	if err != nil {
+		return nil, err
+	}
+	d := &discord{
+		config:    config.Discord,
+		explorer:  NewExplorer(config),
+		templates: templates,
+		client:    &http.Client{Timeout: DefaultWebhookTimeout},
+	}
+	d.queue = newDeliveryQueue(store, deliveryQueueConfig{
+		Name:     d.Name(),
+		Retry:    config.Discord.Retry,
+		MaxBatch: NotificationMaxBatch,
+		Interval: DiscordMinInterval,
+		Send:     d.post,
+	})
+	return d, nil
+}
+
+func (d *discord) Name() string {
+	return "discord"
+}
+
+func (d *discord) Notify(ctx context.Context, event *Event) error {
+	return d.queue.Push(event)
+}
+
+func (d *discord) Close() {
+	d.queue.Close()
+}
+
+var discordEscaper = strings.NewReplacer("[", "\\[", "]", "\\]", "*", "\\*", "_", "\\_", "`", "\\`", "~", "\\~")
+
+func discordLink(text, url string) string {
+	return fmt.Sprintf("[%s](%s)", discordEscaper.Replace(text), url)
+}
+
+// Renders events into a single message, transfers get embeds and other events go to the content.
+func (d *discord) render(events []*Event) *discordMessage {
+	msg := &discordMessage{
+		Username: d.config.Username,
+	}
+	var content []string
+	for _, event := range events {
+		if event.Transfer == nil {
+			content = append(content, d.templates.RenderWithWarnings(event))
+			continue
+		}
+		msg.Embeds = append(msg.Embeds, d.renderEmbed(event))
+	}
+	msg.Content = strings.Join(content, "\n")
+	return msg
+}
+
+func (d *discord) renderEmbed(event *Event) *discordEmbed {
+	color := discordColorReceived
+	if event.Transfer.Direction == Sent {
+		color = discordColorSent
+	}
+	embed := &discordEmbed{
+		Title:     d.templates.Render(event),
+		Url:       d.explorer.TxUrl(event.Transfer.TxHash),
+		Color:     color,
+		Timestamp: event.Time.UTC().Format(time.RFC3339),
+		Footer:    &discordEmbedFooter{Text: fmt.Sprintf("Block %d", event.Transfer.BlockNumber)},
+	}
+	if len(event.Warnings) > 0 {
+		embed.Color = discordColorWarning
+		lines := make([]string, 0, len(event.Warnings))
+		for _, warning := range event.Warnings {
+			lines = append(lines, fmt.Sprintf("%s **%s**", WarningSign, discordEscaper.Replace(warning)))
+		}
+		embed.Description = strings.Join(lines, "\n")
+	}
+	for _, f := range transferFields(event, d.explorer, discordLink, discordEscaper.Replace) {
+		embed.Fields = append(embed.Fields, &discordEmbedField{
+			Name:   f.Name,
+			Value:  f.Value,
+			Inline: true,
+		})
+	}
+	return embed
+}
+
+func (d *discord) post(ctx context.Context, events []*Event) error {
+	body, err := json.Marshal(d.render(events))
+	if err != nil {
+		return Permanent(err)
+	}
+	return postJSON(ctx, d.client, d.config.WebhookUrl, nil, body)
+}
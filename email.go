@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	EmailModeImmediate = "immediate"
+	EmailModeDigest    = "digest"
+
+	EmailDigestHourly = "hourly"
+	EmailDigestDaily  = "daily"
+)
+
+type EmailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// Either "immediate" (default) or "digest".
+	Mode string `yaml:"mode"`
+	// Digest period, either "hourly" or "daily" (default).
+	Digest string `yaml:"digest"`
+	// Optional aliases or addresses of accounts to email about, all accounts by default.
+	Accounts []string `yaml:"accounts"`
+	// Render the subject, the first line of the body and digest entries.
+	Templates TemplatesConfig `yaml:"templates"`
+	Retry     RetryConfig     `yaml:"retry"`
+}
+
+const emailEventText = `{{ range .Warnings }}*** WARNING: {{ . }} ***
+{{ end }}{{ .Message }}
+{{ with .Transfer }}
+Amount:       {{ $.Value }}{{ with $.Fiat }} (≈ {{ . }}){{ end }}
+Token:        {{ .Token.Symbol }}
+Counterparty: {{ $.Counterparty }}
+New balance:  {{ $.Balance }}
+Block:        {{ .BlockNumber }}
+Transaction:  {{ txUrl .TxHash }}
+{{ end }}`
+
+const emailEventHtml = `{{ range .Warnings }}<p style="background:#fdecea;color:#b71c1c;border:1px solid #b71c1c;padding:8px"><b>⚠️ Warning: {{ . }}</b></p>
+{{ end }}<p><b>{{ .Message }}</b></p>
+{{ with .Transfer }}<table>
+<tr><td>Amount</td><td>{{ $.Value }}{{ with $.Fiat }} (≈ {{ . }}){{ end }}</td></tr>
+<tr><td>Token</td><td>{{ .Token.Symbol }}</td></tr>
+<tr><td>Counterparty</td><td>{{ $.Counterparty }}</td></tr>
+<tr><td>New balance</td><td>{{ $.Balance }}</td></tr>
+<tr><td>Block</td><td>{{ .BlockNumber }}</td></tr>
+</table>
+<p><a href="{{ txUrl .TxHash }}">View transaction</a></p>
+{{ end }}`
+
+const emailDigestText = `Transfers from {{ .From.Format "2006-01-02 15:04" }} to {{ .To.Format "2006-01-02 15:04" }}
+{{ range .Accounts }}
+== {{ .Account }} ==
+{{ range .Totals }}Total {{ .Kind }}: {{ .Value }}
+{{ end }}{{ range .Events }}{{ .Time.Format "2006-01-02 15:04:05" }}  {{ if .Warnings }}[WARNING: {{ join .Warnings "; " }}] {{ end }}{{ .Message }}  {{ txUrl .Transfer.TxHash }}
+{{ end }}{{ end }}`
+
+const emailDigestHtml = `<p>Transfers from {{ .From.Format "2006-01-02 15:04" }} to {{ .To.Format "2006-01-02 15:04" }}</p>
+{{ range .Accounts }}<h3>{{ .Account }}</h3>
+<ul>{{ range .Totals }}<li>Total {{ .Kind }}: <b>{{ .Value }}</b></li>{{ end }}</ul>
+<table>{{ range .Events }}
+<tr><td>{{ .Time.Format "2006-01-02 15:04:05" }}</td><td>{{ range .Warnings }}<b style="color:#b71c1c">⚠️ {{ . }}</b><br>{{ end }}{{ .Message }}</td><td><a href="{{ txUrl .Transfer.TxHash }}">tx</a></td></tr>{{ end }}
+</table>
+{{ end }}`
+
+type emailDigestTotal struct {
+	Kind  EventKind
+	Value string
+}
+
+type emailDigestAccount struct {
+	Account string
+	Totals  []*emailDigestTotal
+	Events  []*Event
+}
+
+type emailDigest struct {
+	From     time.Time
+	To       time.Time
+	Accounts []*emailDigestAccount
+}
+
+type emailContent struct {
+	Subject string
+	Text    string
+	Html    string
+}
+
+type emailTemplates struct {
+	eventText  *template.Template
+	eventHtml  *htmltemplate.Template
+	digestText *template.Template
+	digestHtml *htmltemplate.Template
+}
+
+func newEmailTemplates(explorer Explorer) *emailTemplates {
+	funcs := map[string]interface{}{
+		"txUrl": explorer.TxUrl,
+		"join":  strings.Join,
+	}
+	return &emailTemplates{
+		eventText:  template.Must(template.New("event").Funcs(funcs).Parse(emailEventText)),
+		eventHtml:  htmltemplate.Must(htmltemplate.New("event").Funcs(funcs).Parse(emailEventHtml)),
+		digestText: template.Must(template.New("digest").Funcs(funcs).Parse(emailDigestText)),
+		digestHtml: htmltemplate.Must(htmltemplate.New("digest").Funcs(funcs).Parse(emailDigestHtml)),
+	}
+}
+
+type email struct {
+	config    *EmailConfig
+	store     Store
+	templates *emailTemplates
+	messages  *MessageTemplates
+	format    token.Format
+	accounts  map[common.Address]bool
+	queue     *deliveryQueue
+	stopCh    chan struct{}
+	waitStop  sync.WaitGroup
+}
+
+// Returns nil notifier if email is not configured.
+func NewEmail(config *Config, store Store) (Notifier, error) {
+	if config.Email == nil {
+		return nil, nil
+	}
+	messages, err := NewMessageTemplates(config, config.Email.Templates, noEscape)
+	if err != nil {
+		return nil, err
+	}
+	format, err := NewAmountFormat(config)
+	if err != nil {
+		return nil, err
+	}
+	e := &email{
+		config:    config.Email,
+		store:     store,
+		templates: newEmailTemplates(NewExplorer(config)),
+		messages:  messages,
+		format:    format,
+		stopCh:    make(chan struct{}),
+	}
+	if len(config.Email.Accounts) > 0 {
+		// Keyed by address, aliases may change on reloads which keep the notifier.
+		e.accounts = make(map[common.Address]bool)
+		accounts := NewAccounts(config)
+		for _, acc := range config.Email.Accounts {
+			if addr, ok := accounts.Find(acc); ok {
+				e.accounts[addr] = true
+			}
+		}
+	}
+	e.queue = newDeliveryQueue(store, deliveryQueueConfig{
+		Name:  e.Name(),
+		Retry: config.Email.Retry,
+		Send: func(ctx context.Context, events []*Event) error {
+			return e.sendEvent(ctx, events[0])
+		},
+	})
+	if config.Email.Mode == EmailModeDigest {
+		e.waitStop.Add(1)
+		go e.digestLoop()
+	}
+	return e, nil
+}
+
+func (e *email) Name() string {
+	return "email"
+}
+
+func (e *email) digestBucket() string {
+	return "digest/" + e.Name()
+}
+
+func (e *email) Notify(ctx context.Context, event *Event) error {
+	// Events without an account, e.g. status ones, are not filtered.
+	if addr, ok := event.AccountAddress(); ok && e.accounts != nil && !e.accounts[addr] {
+		return nil
+	}
+	if e.config.Mode != EmailModeDigest {
+		return e.queue.Push(event)
+	}
+	// Balance alerts can't wait for the digest.
+	if event.Alert != nil {
+		return e.queue.Push(event)
+	}
+	if event.Transfer == nil {
+		return nil
+	}
+	return e.store.Put(e.digestBucket(), nextQueueKey(), event)
+}
+
+func (e *email) Close() {
+	close(e.stopCh)
+	e.waitStop.Wait()
+	e.queue.Close()
+}
+
+// Returns a copy of the event with the message rendered by the email templates, for the body templates.
+func (e *email) render(event *Event) *Event {
+	rendered := *event
+	rendered.Message = e.messages.Render(event)
+	return &rendered
+}
+
+func (e *email) sendEvent(ctx context.Context, event *Event) error {
+	event = e.render(event)
+	content := &emailContent{
+		Subject: event.Message,
+	}
+	if len(event.Warnings) > 0 {
+		content.Subject = WarningSign + " SUSPICIOUS: " + content.Subject
+	}
+	text := &strings.Builder{}
+	if err := e.templates.eventText.Execute(text, event); err != nil {
+		return Permanent(err)
+	}
+	html := &strings.Builder{}
+	if err := e.templates.eventHtml.Execute(html, event); err != nil {
+		return Permanent(err)
+	}
+	content.Text, content.Html = text.String(), html.String()
+	return e.send(ctx, content)
+}
+
+func (e *email) digestName() string {
+	if e.config.Digest == "" {
+		return EmailDigestDaily
+	}
+	return e.config.Digest
+}
+
+func (e *email) digestPeriod() time.Duration {
+	if e.config.Digest == EmailDigestHourly {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Returns the start of the next digest period in local time.
+func (e *email) nextDigest(now time.Time) time.Time {
+	if e.config.Digest == EmailDigestHourly {
+		return now.Truncate(time.Hour).Add(time.Hour)
+	}
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
+
+func (e *email) digestLoop() {
+	defer e.waitStop.Done()
+
+	for {
+		timer := time.NewTimer(time.Until(e.nextDigest(time.Now())))
+		select {
+		case <-e.stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := e.flushDigest(); err != nil {
+			log.Printf("Failed to send email digest, will retry with the next one: %v", err)
+		}
+	}
+}
+
+// Sends all stored events as a single digest email and removes them on success.
+func (e *email) flushDigest() error {
+	var keys [][]byte
+	var events []*Event
+	err := e.store.ForEach(e.digestBucket(), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		event := &Event{}
+		if err := decode(event); err != nil {
+			return false, err
+		}
+		keys = append(keys, key)
+		events = append(events, e.render(event))
+		return true, nil
+	})
+	if err != nil || len(events) == 0 {
+		return err
+	}
+
+	now := time.Now()
+	digest := newEmailDigest(events, now.Add(-e.digestPeriod()), now, e.format)
+	content := &emailContent{
+		Subject: fmt.Sprintf("Transfers digest (%s): %d transfer(s)", e.digestName(), len(events)),
+	}
+	text := &strings.Builder{}
+	if err := e.templates.digestText.Execute(text, digest); err != nil {
+		return err
+	}
+	html := &strings.Builder{}
+	if err := e.templates.digestHtml.Execute(html, digest); err != nil {
+		return err
+	}
+	content.Text, content.Html = text.String(), html.String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultWebhookTimeout)
+	defer cancel()
+	if err := e.send(ctx, content); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := e.store.Delete(e.digestBucket(), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Groups events by account and sums transferred values per token and direction.
+func newEmailDigest(events []*Event, from, to time.Time, format token.Format) *emailDigest {
+	digest := &emailDigest{
+		From: from,
+		To:   to,
+	}
+	if len(events) > 0 && events[0].Time.Before(from) {
+		digest.From = events[0].Time
+	}
+
+	// Keyed by address, distinct tokens may share a symbol.
+	type totalKey struct {
+		kind  EventKind
+		token common.Address
+	}
+	byAccount := make(map[string]*emailDigestAccount)
+	sums := make(map[string]map[totalKey]*big.Int)
+	tokens := make(map[common.Address]*token.Token)
+	for _, event := range events {
+		acc, has := byAccount[event.Account]
+		if !has {
+			acc = &emailDigestAccount{Account: event.Account}
+			byAccount[event.Account] = acc
+			sums[event.Account] = make(map[totalKey]*big.Int)
+			digest.Accounts = append(digest.Accounts, acc)
+		}
+		acc.Events = append(acc.Events, event)
+
+		key := totalKey{kind: event.Kind, token: event.Transfer.Token.Address}
+		sum, has := sums[event.Account][key]
+		if !has {
+			sum = new(big.Int)
+			sums[event.Account][key] = sum
+		}
+		sum.Add(sum, &event.Transfer.Value)
+		tokens[key.token] = event.Transfer.Token
+	}
+
+	for _, acc := range digest.Accounts {
+		keys := make([]totalKey, 0, len(sums[acc.Account]))
+		for key := range sums[acc.Account] {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].kind != keys[j].kind {
+				return keys[i].kind < keys[j].kind
+			}
+			if a, b := tokens[keys[i].token].Symbol, tokens[keys[j].token].Symbol; a != b {
+				return a < b
+			}
+			return keys[i].token.Hex() < keys[j].token.Hex()
+		})
+		for _, key := range keys {
+			acc.Totals = append(acc.Totals, &emailDigestTotal{
+				Kind:  key.kind,
+				Value: tokens[key.token].FormatValue(sums[acc.Account][key], format),
+			})
+		}
+	}
+	return digest
+}
+
+func (e *email) send(ctx context.Context, content *emailContent) error {
+	msg, err := e.buildMessage(content)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	port := e.config.Port
+	if port == 0 {
+		port = DefaultEmailPort
+	}
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: e.config.Host}
+
+	dialer := &net.Dialer{Timeout: DefaultWebhookTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	conn.SetDeadline(time.Now().Add(DefaultWebhookTimeout))
+
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)); err != nil {
+			return Permanent(err)
+		}
+	}
+	if err := client.Mail(e.config.From); err != nil {
+		return err
+	}
+	for _, to := range e.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Builds a multipart/alternative message with plain-text and HTML parts.
+func (e *email) buildMessage(content *emailContent) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	boundary := make([]byte, 16)
+	if _, err := rand.Read(boundary); err != nil {
+		return nil, err
+	}
+	mw := multipart.NewWriter(buf)
+	if err := mw.SetBoundary(hex.EncodeToString(boundary)); err != nil {
+		return nil, err
+	}
+
+	header := &bytes.Buffer{}
+	fmt.Fprintf(header, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(header, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(header, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", content.Subject))
+	fmt.Fprintf(header, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(header, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(header, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", content.Text},
+		{"text/html; charset=utf-8", content.Html},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(header.Bytes(), buf.Bytes()...), nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Accepts a single SMTP session and sends the message data to the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				data := &strings.Builder{}
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(line, "."))
+				}
+				messages <- data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+// Returns the decoded plain-text part of a multipart/alternative message.
+func plainTextPart(t *testing.T, message string) string {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("no text/plain part: %v", err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			body, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(body)
+		}
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewStore("store")
+	defer store.Close()
+
+	addr, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	config := &Config{Email: &EmailConfig{
+		Host: host,
+		Port: portNum,
+		From: "listener@example.com",
+		To:   []string{"me@example.com"},
+		Mode: EmailModeDigest,
+		Templates: TemplatesConfig{
+			EventReceived: "{{ .Account }} got {{ .Message }}",
+		},
+	}}
+	notifier, err := NewEmail(config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+	e := notifier.(*email)
+
+	account := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	usdt := &token.Token{Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), Symbol: "USDT", Decimals: 6}
+	fakeUSDT := &token.Token{Address: common.HexToAddress("0x00000000000000000000000000000000000000f1"), Symbol: "USDT", Decimals: 6}
+	received := func(t *token.Token, value int64, message string) *Event {
+		transfer := &Transfer{Direction: Received, To: account, Token: t}
+		transfer.Value.SetInt64(value)
+		return &Event{Kind: EventReceived, Time: time.Now(), Transfer: transfer, Account: "Main", Message: message}
+	}
+	for _, event := range []*Event{
+		received(usdt, 1_000_000, "first"),
+		received(usdt, 2_500_000, "second"),
+		received(fakeUSDT, 1_000_000_000, "spam"),
+	} {
+		if err := e.Notify(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.flushDigest(); err != nil {
+		t.Fatal(err)
+	}
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("digest was not sent")
+	}
+
+	text := plainTextPart(t, message)
+	for _, want := range []string{
+		"== Main ==",
+		"Total received: 3.5 USDT",
+		"Total received: 1,000 USDT",
+		"Main got first",
+		"Main got second",
+		"Main got spam",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("digest does not contain %q:\n%s", want, text)
+		}
+	}
+
+	// Sent events are removed from the digest.
+	var left int
+	store.ForEach(e.digestBucket(), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		left++
+		return true, nil
+	})
+	if left != 0 {
+		t.Errorf("%d events left after the digest was sent", left)
+	}
+}
+
+func TestEmailEventTemplates(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewStore("store")
+	defer store.Close()
+
+	addr, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	config := &Config{Email: &EmailConfig{
+		Host: host,
+		Port: portNum,
+		From: "listener@example.com",
+		To:   []string{"me@example.com"},
+		Templates: TemplatesConfig{
+			EventStatus: "Listener says: {{ .Message }}",
+		},
+	}}
+	notifier, err := NewEmail(config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+
+	if err := notifier.Notify(context.Background(), NewStatusEvent("started")); err != nil {
+		t.Fatal(err)
+	}
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("email was not sent")
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Listener says: started" {
+		t.Errorf("subject = %q", subject)
+	}
+	if text := plainTextPart(t, message); !strings.HasPrefix(text, "Listener says: started") {
+		t.Errorf("body is not rendered by the template:\n%s", text)
+	}
+}
+
+func TestEmailAccountsFilter(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewStore("store")
+	defer store.Close()
+
+	addr, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	savings := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	checking := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	config := &Config{
+		Accounts: []AccountConfig{{Address: savings.Hex(), Alias: "Savings"}, {Address: checking.Hex(), Alias: "Checking"}},
+		Email: &EmailConfig{
+			Host:     host,
+			Port:     portNum,
+			From:     "listener@example.com",
+			To:       []string{"me@example.com"},
+			Accounts: []string{"Savings"},
+		},
+	}
+	notifier, err := NewEmail(config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+
+	// The event alias matches the filtered one, but the account does not.
+	transfer := &Transfer{Direction: Received, To: checking, Token: token.ETHToken}
+	other := &Event{Kind: EventReceived, Time: time.Now(), Transfer: transfer, Account: "Savings", Message: "other account"}
+	for _, event := range []*Event{other, NewStatusEvent("started")} {
+		if err := notifier.Notify(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("status email was not sent")
+	}
+	if text := plainTextPart(t, message); !strings.Contains(text, "started") {
+		t.Errorf("expected the status email, got:\n%s", text)
+	}
+}
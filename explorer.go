@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Explorer builds block explorer links (Etherscan-compatible URL layout).
+type Explorer struct {
+	baseUrl string
+}
+
+func NewExplorer(config *Config) Explorer {
+	baseUrl := config.ExplorerUrl
+	if baseUrl == "" {
+		baseUrl = DefaultExplorerUrl
+	}
+	return Explorer{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+	}
+}
+
+func (e Explorer) TxUrl(hash common.Hash) string {
+	return e.baseUrl + "/tx/" + hash.Hex()
+}
+
+func (e Explorer) AddressUrl(addr common.Address) string {
+	return e.baseUrl + "/address/" + addr.Hex()
+}
+
+func (e Explorer) TokenUrl(addr common.Address) string {
+	return e.baseUrl + "/token/" + addr.Hex()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/andrei-toptal/eth-listener/token"
+)
+
+type FormatConfig struct {
+	// Separators style: "en" (default, 1,234.5), "de" (1.234,5), "fr" (1 234,5), "ch" (1'234.5) or "plain" (1234.5).
+	Locale string `yaml:"locale"`
+	// Max number of fraction digits, 0 rounds to whole units. Exact values if not set.
+	Precision *int `yaml:"precision"`
+	// Keeps trailing fraction zeros up to precision.
+	KeepZeros bool `yaml:"keep-zeros"`
+	// Renders large values like 1.2M.
+	Compact bool `yaml:"compact"`
+}
+
+// NewAmountFormat returns the format of token amounts in messages, token.DefaultFormat if not configured.
+func NewAmountFormat(config *Config) (token.Format, error) {
+	if config.Format == nil {
+		return token.DefaultFormat, nil
+	}
+	f := token.DefaultFormat
+	if config.Format.Locale != "" {
+		var err error
+		if f, err = token.LocaleFormat(config.Format.Locale); err != nil {
+			return f, err
+		}
+	}
+	if config.Format.Precision != nil {
+		f.Precision = *config.Format.Precision
+	}
+	f.KeepZeros = config.Format.KeepZeros
+	f.Compact = config.Format.Compact
+	return f, nil
+}
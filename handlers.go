@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
 	"math/big"
+	"strings"
+	"time"
 
+	"github.com/andrei-toptal/eth-listener/price"
 	"github.com/andrei-toptal/eth-listener/token"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
@@ -13,69 +16,148 @@ import (
 )
 
 func handleTransfer(transfer *Transfer, app *App, ctx context.Context) {
-	value := transfer.Token.RenderValue(&transfer.Value)
+	accounts := app.Accounts()
+	format := app.AmountFormat()
+	value := transfer.Token.FormatValue(&transfer.Value, format)
+	now := time.Now()
 
-	getBalanceStr := func(addr common.Address) string {
-		balanceStr := "N/A"
-		balance, err := app.tokensManager.FetchBalance(ctx, transfer.Token, addr)
-		if err == nil {
-			balanceStr = transfer.Token.RenderValue(balance)
-		} else {
-			log.Printf("Failed to fetch balance for %s: %v", transfer.Token.Symbol, err)
+	// Checked before the counterparty is recorded, so it is not compared with itself.
+	spam := app.Spam()
+	spam.Check(transfer)
+	valuation := app.Valuation()
+	// Spam tokens are not worth price lookups, which hold up handling of the following transfers.
+	if len(transfer.Suspicious) == 0 {
+		transfer.Fiat = valuation.Values(price.WithBlock(ctx, transfer.BlockNumber), transfer.Token, &transfer.Value)
+	}
+
+	if err := app.history.Add(transfer, now); err != nil {
+		log.Printf("Failed to save transfer to history: %v", err)
+	}
+	if err := app.accountTokens.Add(transfer, now); err != nil {
+		log.Printf("Failed to save account token: %v", err)
+	}
+	if IsLegitimateTransfer(transfer) {
+		if err := app.counterparties.Add(transfer.Account(), transfer.Counterparty(), now); err != nil {
+			log.Printf("Failed to save counterparty: %v", err)
 		}
-		return balanceStr
 	}
 
-	var msg string
+	// Sent transfers are made by the account owner, so they are notified even if suspicious.
+	if len(transfer.Suspicious) > 0 && transfer.Direction == Received && spam.Suppress() {
+		log.Printf("Suppressed notification of suspicious %s transfer %s: %s",
+			accounts.Lookup(transfer.Account()), transfer.TxHash.Hex(), strings.Join(transfer.Suspicious, "; "))
+		return
+	}
+
+	decision := app.Rules().Evaluate(transfer, now)
+	// Address poisoning warnings are not subject to rules, dust thresholds would hide them otherwise.
+	if transfer.LookalikeOf != nil {
+		decision.Notify = true
+		decision.Severity = SeverityCritical
+	}
+	if !decision.Notify {
+		log.Printf("Suppressed notification of %s transfer %s: %s",
+			accounts.Lookup(transfer.Account()), transfer.TxHash.Hex(), decision.Reason)
+		return
+	}
+
+	event := &Event{
+		Time:     now,
+		Severity: decision.Severity,
+		Transfer: transfer,
+		Value:    value,
+		Fiat:     transfer.Fiat.String(),
+		Balance:  "N/A",
+		Warnings: transfer.Suspicious,
+	}
 	switch transfer.Direction {
 	case Sent:
-		msg = fmt.Sprintf("%s sent %s to %s, new balance: %s",
-			app.accounts.Lookup(transfer.From),
-			value,
-			app.accounts.Lookup(transfer.To),
-			getBalanceStr(transfer.From))
+		event.Kind = EventSent
+		event.Account = accounts.Lookup(transfer.From)
+		event.Counterparty = accounts.Lookup(transfer.To)
 
 	case Received:
-		msg = fmt.Sprintf("%s received %s from %s, new balance: %s",
-			app.accounts.Lookup(transfer.To),
-			value,
-			app.accounts.Lookup(transfer.From),
-			getBalanceStr(transfer.To))
+		event.Kind = EventReceived
+		event.Account = accounts.Lookup(transfer.To)
+		event.Counterparty = accounts.Lookup(transfer.From)
+	}
+
+	// Balance right after the transfer's block, not the current one which is off during catch-up.
+	balance, err := app.tokensManager.FetchBalanceAt(ctx, transfer.Token, transfer.Account(), transfer.BlockHash)
+	if err == nil {
+		event.Balance = transfer.Token.FormatValue(balance, format)
+		if len(transfer.Suspicious) == 0 {
+			event.BalanceFiat = valuation.Values(price.WithBlock(ctx, transfer.BlockNumber), transfer.Token, balance).String()
+		}
+	} else {
+		log.Printf("Failed to fetch balance for %s: %v", transfer.Token.Symbol, err)
 	}
+	templates := app.Templates()
+	event.Message = templates.Render(event)
 
-	log.Println(msg)
-	app.telegram.Notify(msg)
+	log.Println(templates.RenderWithWarnings(event))
+	app.Notifier().Notify(ctx, event)
 }
 
-func handleHeader(ctx context.Context, header *types.Header, transfersCh chan<- *Transfer, app *App) {
+// Returns false if the block could not be processed completely.
+func handleHeader(ctx context.Context, header *types.Header, transfersCh chan<- *Transfer, app *App) bool {
 	block, err := app.client.BlockByNumber(ctx, header.Number)
 	if err != nil {
-		return
+		log.Printf("Failed to fetch block %s: %v", header.Number, err)
+		app.status.RpcFailed(err)
+		return false
 	}
+	accounts := app.Accounts()
 
 	for _, tx := range block.Transactions() {
 		msg, err := tx.AsMessage(types.LatestSignerForChainID(tx.ChainId()), big.NewInt(1))
 		if err != nil {
 			continue
 		}
-		if tx.To() != nil {
-			if _, has := app.accounts[*tx.To()]; has && tx.Value() != nil {
-				transfersCh <- &Transfer{
-					Direction: Received,
-					From:      msg.From(),
-					To:        *tx.To(),
-					Value:     *tx.Value(),
-					Token:     token.ETHToken,
-				}
+		var received, sent bool
+		if tx.To() != nil && tx.Value() != nil {
+			_, received = accounts[*tx.To()]
+		}
+		if msg.Value() != nil && msg.To() != nil {
+			_, sent = accounts[msg.From()]
+		}
+		if !received && !sent {
+			continue
+		}
+
+		// Reverted transactions transfer no value, only the gas is paid.
+		receipt, err := app.client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			log.Printf("Failed to fetch receipt of %s: %v", tx.Hash().Hex(), err)
+			app.status.RpcFailed(err)
+			return false
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			continue
+		}
+
+		if received {
+			transfersCh <- &Transfer{
+				Direction:   Received,
+				From:        msg.From(),
+				To:          *tx.To(),
+				Value:       *tx.Value(),
+				Token:       token.ETHToken,
+				TxHash:      tx.Hash(),
+				BlockNumber: block.NumberU64(),
+				BlockHash:   block.Hash(),
 			}
 		}
-		if _, has := app.accounts[msg.From()]; has && msg.Value() != nil && msg.To() != nil {
+		if sent {
 			transfersCh <- &Transfer{
-				Direction: Sent,
-				From:      msg.From(),
-				To:        *tx.To(),
-				Value:     *tx.Value(),
-				Token:     token.ETHToken,
+				Direction:   Sent,
+				From:        msg.From(),
+				To:          *tx.To(),
+				Value:       *tx.Value(),
+				Token:       token.ETHToken,
+				TxHash:      tx.Hash(),
+				BlockNumber: block.NumberU64(),
+				BlockHash:   block.Hash(),
 			}
 		}
 	}
@@ -85,7 +167,9 @@ func handleHeader(ctx context.Context, header *types.Header, transfersCh chan<-
 	filterQuery.ToBlock = block.Number()
 	logs, err := app.client.FilterLogs(ctx, filterQuery)
 	if err != nil {
-		return
+		log.Printf("Failed to fetch logs of block %s: %v", header.Number, err)
+		app.status.RpcFailed(err)
+		return false
 	}
 
 	for _, logItem := range logs {
@@ -93,9 +177,13 @@ func handleHeader(ctx context.Context, header *types.Header, transfersCh chan<-
 			continue
 		}
 
-		token, err := app.tokensManager.GetToken(ctx, logItem.Address)
+		t, err := app.tokensManager.GetToken(ctx, logItem.Address)
 		if err != nil {
-			log.Printf("Skipping log for non-ERC20 contract: %v", err)
+			// Blocked tokens and remembered failures are skipped silently, they were reported already.
+			var lookupErr *token.LookupError
+			if err != token.ErrBlocked && !(errors.As(err, &lookupErr) && lookupErr.Cached) {
+				log.Printf("Skipping transfer log: %v", err)
+			}
 			continue
 		}
 
@@ -109,23 +197,32 @@ func handleHeader(ctx context.Context, header *types.Header, transfersCh chan<-
 		}
 		from := common.HexToAddress(logItem.Topics[1].Hex())
 		to := common.HexToAddress(logItem.Topics[2].Hex())
-		if _, has := app.accounts[from]; has {
+		if _, has := accounts[from]; has {
 			transfersCh <- &Transfer{
-				Direction: Sent,
-				From:      from,
-				To:        to,
-				Value:     *transfer.Value,
-				Token:     token,
+				Direction:   Sent,
+				From:        from,
+				To:          to,
+				Value:       *transfer.Value,
+				Token:       t,
+				TxHash:      logItem.TxHash,
+				BlockNumber: logItem.BlockNumber,
+				BlockHash:   logItem.BlockHash,
 			}
 		}
-		if _, has := app.accounts[to]; has {
+		if _, has := accounts[to]; has {
 			transfersCh <- &Transfer{
-				Direction: Received,
-				From:      from,
-				To:        to,
-				Value:     *transfer.Value,
-				Token:     token,
+				Direction:   Received,
+				From:        from,
+				To:          to,
+				Value:       *transfer.Value,
+				Token:       t,
+				TxHash:      logItem.TxHash,
+				BlockNumber: logItem.BlockNumber,
+				BlockHash:   logItem.BlockHash,
 			}
 		}
 	}
+
+	app.status.BlockProcessed(header)
+	return true
 }
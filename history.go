@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const historyBucket = "history"
+
+type HistoryEntry struct {
+	Time     time.Time
+	Transfer *Transfer
+}
+
+// History persists observed transfers of the watched accounts.
+type History interface {
+	Add(transfer *Transfer, t time.Time) error
+	// Returns up to limit latest entries, newest first.
+	// When account is not nil, only its transfers are returned.
+	Latest(account *common.Address, limit int) ([]*HistoryEntry, error)
+	// Iterates all entries, oldest first, until fn returns false or an error.
+	ForEach(fn func(entry *HistoryEntry) (bool, error)) error
+	// Same as ForEach but newest first.
+	ForEachReverse(fn func(entry *HistoryEntry) (bool, error)) error
+}
+
+type history struct {
+	store Store
+}
+
+func NewHistory(store Store) History {
+	return &history{
+		store: store,
+	}
+}
+
+func (h *history) Add(transfer *Transfer, t time.Time) error {
+	return h.store.Put(historyBucket, nextQueueKey(), &HistoryEntry{
+		Time:     t,
+		Transfer: transfer,
+	})
+}
+
+func (h *history) Latest(account *common.Address, limit int) ([]*HistoryEntry, error) {
+	var entries []*HistoryEntry
+	err := h.store.ForEachReverse(historyBucket, func(key []byte, decode func(value interface{}) error) (bool, error) {
+		entry := &HistoryEntry{}
+		if err := decode(entry); err != nil {
+			return false, err
+		}
+		if account == nil || entry.Transfer.Account() == *account {
+			entries = append(entries, entry)
+		}
+		return len(entries) < limit, nil
+	})
+	return entries, err
+}
+
+func (h *history) ForEach(fn func(entry *HistoryEntry) (bool, error)) error {
+	return h.store.ForEach(historyBucket, func(key []byte, decode func(value interface{}) error) (bool, error) {
+		entry := &HistoryEntry{}
+		if err := decode(entry); err != nil {
+			return false, err
+		}
+		return fn(entry)
+	})
+}
+
+func (h *history) ForEachReverse(fn func(entry *HistoryEntry) (bool, error)) error {
+	return h.store.ForEachReverse(historyBucket, func(key []byte, decode func(value interface{}) error) (bool, error) {
+		entry := &HistoryEntry{}
+		if err := decode(entry); err != nil {
+			return false, err
+		}
+		return fn(entry)
+	})
+}
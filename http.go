@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type HTTPConfig struct {
+	// Address to listen on, e.g. "127.0.0.1:8080".
+	Listen string `yaml:"listen"`
+	// When set, requests must carry an "Authorization: Bearer <token>" header.
+	// Required unless listening on a loopback address.
+	Token string `yaml:"token"`
+}
+
+type httpPortfolioEntry struct {
+	Token webhookToken `json:"token"`
+	// Raw balance in the token's smallest units and rendered with the configured format.
+	Balance      string            `json:"balance"`
+	Formatted    string            `json:"formatted"`
+	Fiat         map[string]string `json:"fiat,omitempty"`
+	Transfers    int               `json:"transfers"`
+	LastTransfer *time.Time        `json:"last_transfer,omitempty"`
+}
+
+type httpPortfolio struct {
+	Account string               `json:"account"`
+	Address string               `json:"address"`
+	Tokens  []httpPortfolioEntry `json:"tokens"`
+	Total   map[string]string    `json:"total,omitempty"`
+	Failed  []webhookToken       `json:"failed,omitempty"`
+	Spam    int                  `json:"spam_hidden,omitempty"`
+}
+
+// Returns the listen address, empty if the HTTP API is disabled.
+func httpListen(config *Config) string {
+	if config.HTTP == nil {
+		return ""
+	}
+	return config.HTTP.Listen
+}
+
+// RunHTTPServer serves the read-only HTTP API until ctx is done, if configured.
+// The listen address is only read on start, the token is applied on config reloads.
+func RunHTTPServer(ctx context.Context, app *App) {
+	config := app.Config().HTTP
+	if config == nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/portfolio", func(w http.ResponseWriter, r *http.Request) {
+		handlePortfolio(app, w, r)
+	})
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           httpAuth(app, mux),
+		ReadHeaderTimeout: HTTPReadTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), HTTPShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving HTTP API on %s", config.Listen)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("HTTP server failed: %v", err)
+	}
+}
+
+func httpAuth(app *App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := app.Config().HTTP
+		if config == nil {
+			httpError(w, http.StatusServiceUnavailable, "HTTP API is disabled")
+			return
+		}
+		if config.Token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(config.Token)) != 1 {
+				httpError(w, http.StatusUnauthorized, "invalid or missing token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func httpError(w http.ResponseWriter, status int, message string) {
+	httpJSON(w, status, map[string]string{"error": message})
+}
+
+func httpJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write HTTP response: %v", err)
+	}
+}
+
+// GET /portfolio[?account=<alias or address>...]
+func handlePortfolio(app *App, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	accounts := app.Accounts()
+	var addrs []common.Address
+	for _, arg := range r.URL.Query()["account"] {
+		addr, ok := accounts.Find(arg)
+		if !ok {
+			httpError(w, http.StatusNotFound, "unknown account: "+arg)
+			return
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		addrs = accounts.Sorted()
+	}
+
+	format := app.AmountFormat()
+	portfolios := make([]httpPortfolio, 0, len(addrs))
+	for _, addr := range addrs {
+		p := app.Portfolio(r.Context(), addr)
+		hp := httpPortfolio{
+			Account: accounts.Lookup(addr),
+			Address: addr.Hex(),
+			Tokens:  make([]httpPortfolioEntry, 0, len(p.Entries)),
+			Total:   p.Total.Strings(),
+			Spam:    p.Spam,
+		}
+		for _, entry := range p.Entries {
+			he := httpPortfolioEntry{
+				Token:     newWebhookToken(entry.Token),
+				Balance:   entry.Balance.String(),
+				Formatted: entry.Token.FormatValue(entry.Balance, format),
+				Fiat:      entry.Fiat.Strings(),
+				Transfers: entry.Transfers,
+			}
+			if !entry.LastTransfer.IsZero() {
+				lastTransfer := entry.LastTransfer
+				he.LastTransfer = &lastTransfer
+			}
+			hp.Tokens = append(hp.Tokens, he)
+		}
+		for _, t := range p.Failed {
+			hp.Failed = append(hp.Failed, newWebhookToken(t))
+		}
+		portfolios = append(portfolios, hp)
+	}
+	httpJSON(w, http.StatusOK, map[string]interface{}{"accounts": portfolios})
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -11,6 +13,15 @@ import (
 )
 
 func main() {
+	configPath := flag.String("config", DefaultConfigPath, "path to the config file")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	runCommand(flag.Args(), *configPath)
+
 	log.Println("Starting eth-listener application...")
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -23,11 +34,16 @@ func main() {
 		cancel()
 	}()
 
-	app, err := WireApp(ConfigPath)
+	app, err := WireApp(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer app.tokensDB.Close()
+	defer app.store.Close()
+	defer func() { app.Notifier().Close() }()
+
+	go watchConfig(ctx, *configPath, app)
+	go RunHTTPServer(ctx, app)
 
 	log.Println("Watching for transactions...")
 
@@ -38,6 +54,9 @@ func main() {
 	}
 	defer sub.Unsubscribe()
 
+	monitor := NewBalanceMonitor(app, NewSnapshots(app.store))
+	go monitor.Run(ctx)
+
 	transfersCh := make(chan *Transfer, TransfersChBuffer)
 	go func() {
 		for {
@@ -58,10 +77,12 @@ mainLoop:
 		case err := <-sub.Err():
 			log.Fatalf("Head subscription error: %v", err)
 		case header := <-headsCh:
-			handleHeader(ctx, header, transfersCh, app)
+			if handleHeader(ctx, header, transfersCh, app) {
+				monitor.BlockProcessed(header.Number.Uint64())
+			}
 		}
 	}
 
-	app.telegram.Notify("Bot is shutting down...")
+	app.Notifier().Notify(context.Background(), NewStatusEvent("Bot is shutting down..."))
 	log.Printf("Application stopped.")
 }
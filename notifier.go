@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type EventKind string
+
+const (
+	EventSent     EventKind = "sent"
+	EventReceived EventKind = "received"
+	EventStatus   EventKind = "status"
+	// Balance snapshot alerts.
+	EventLowBalance    EventKind = "low-balance"
+	EventBalanceChange EventKind = "balance-change"
+	// Kinds below are not emitted yet, but can already have templates.
+	EventFailed   EventKind = "failed"
+	EventApproval EventKind = "approval"
+	EventReorg    EventKind = "reorg"
+)
+
+// Event is a structured notification passed to notifiers.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	// One of SeverityInfo, SeverityWarning or SeverityCritical.
+	Severity string
+	// Set for transfer events only.
+	Transfer *Transfer
+	// Set for balance alert events only.
+	Alert *BalanceAlert
+	// Alias (or address) of the watched account.
+	Account string
+	// Alias (or address) of the other side of the transfer.
+	Counterparty string
+	// Rendered transfer value with token symbol, or the unexplained change of balance-change alerts.
+	Value string
+	// Rendered transfer value in fiat currencies, e.g. "1523.44 USD", empty if unknown.
+	Fiat string
+	// Rendered account balance after the transfer, "N/A" if unknown.
+	Balance string
+	// Rendered balance in fiat currencies, empty if unknown.
+	BalanceFiat string
+	// Human-readable one-line summary of the event.
+	Message string
+	// Reasons why the event looks suspicious, e.g. spam token transfers.
+	Warnings []string
+}
+
+// AccountAddress returns the watched account the event is about, false for events like status ones.
+func (e *Event) AccountAddress() (common.Address, bool) {
+	switch {
+	case e.Transfer != nil:
+		return e.Transfer.Account(), true
+	case e.Alert != nil:
+		return e.Alert.Account, true
+	}
+	return common.Address{}, false
+}
+
+func NewStatusEvent(message string) *Event {
+	return &Event{
+		Kind:     EventStatus,
+		Time:     time.Now(),
+		Severity: SeverityInfo,
+		Message:  message,
+	}
+}
+
+// Notifier delivers events to a single outbound channel (sink).
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event *Event) error
+	Close()
+}
+
+// Dispatcher fans out every event to all configured notifiers.
+type Dispatcher struct {
+	notifiers []Notifier
+}
+
+func NewDispatcher(notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+	}
+}
+
+// NewNotifier creates a dispatcher with every notifier enabled in the config.
+func NewNotifier(config *Config, store Store, backend BotBackend) (Notifier, error) {
+	var notifiers []Notifier
+
+	type factory func() (Notifier, error)
+	factories := []factory{
+		func() (Notifier, error) { return NewTelegram(config, store, backend) },
+		func() (Notifier, error) { return NewSlack(config, store) },
+		func() (Notifier, error) { return NewDiscord(config, store) },
+		func() (Notifier, error) { return NewEmail(config, store) },
+	}
+	for _, newNotifier := range factories {
+		n, err := newNotifier()
+		if err != nil {
+			NewDispatcher(notifiers...).Close()
+			return nil, err
+		}
+		if n != nil {
+			notifiers = append(notifiers, n)
+		}
+	}
+	for i := range config.Webhooks {
+		notifiers = append(notifiers, NewWebhook(&config.Webhooks[i], store))
+	}
+
+	for _, n := range notifiers {
+		log.Printf("Enabled %s notifier", n.Name())
+	}
+	if len(notifiers) == 0 {
+		log.Println("No notifiers configured, transfers are only logged")
+	}
+	return NewDispatcher(notifiers...), nil
+}
+
+func (d *Dispatcher) Name() string {
+	return "dispatcher"
+}
+
+// Notify delivers the event to all notifiers concurrently.
+// Failures are logged per notifier and do not affect the others.
+func (d *Dispatcher) Notify(ctx context.Context, event *Event) error {
+	var wg sync.WaitGroup
+	for _, n := range d.notifiers {
+		wg.Add(1)
+		go func(n Notifier) {
+			defer wg.Done()
+			if err := n.Notify(ctx, event); err != nil {
+				log.Printf("Failed to notify via %s: %v", n.Name(), err)
+			}
+		}(n)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (d *Dispatcher) Close() {
+	for _, n := range d.notifiers {
+		n.Close()
+	}
+}
+
+type eventField struct {
+	Name  string
+	Value string
+}
+
+// Returns transfer details shown by rich notifiers, links are rendered and plain values escaped by the given funcs.
+func transferFields(event *Event, explorer Explorer, link func(text, url string) string, escape func(string) string) []eventField {
+	t := event.Transfer
+	counterpartyName, counterparty := "To", t.To
+	if t.Direction == Received {
+		counterpartyName, counterparty = "From", t.From
+	}
+
+	tokenValue := escape(t.Token.Symbol)
+	if t.Token.Address != token.ETHToken.Address {
+		tokenValue = link(t.Token.Symbol, explorer.TokenUrl(t.Token.Address))
+	}
+
+	amount := event.Value
+	if event.Fiat != "" {
+		amount += " (≈ " + event.Fiat + ")"
+	}
+	return []eventField{
+		{Name: "Amount", Value: escape(amount)},
+		{Name: "Token", Value: tokenValue},
+		{Name: counterpartyName, Value: link(event.Counterparty, explorer.AddressUrl(counterparty))},
+		{Name: "New balance", Value: escape(event.Balance)},
+	}
+}
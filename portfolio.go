@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PortfolioEntry is a token held by the account.
+type PortfolioEntry struct {
+	Token   *token.Token
+	Balance *big.Int
+	// Empty if prices are not configured or unknown for the token.
+	Fiat FiatValues
+	// Number of transfers in history and the time of the latest one, zero for ETH without transfers.
+	Transfers    int
+	LastTransfer time.Time
+}
+
+// Portfolio lists non-zero balances of every token the account has interacted with.
+type Portfolio struct {
+	Account common.Address
+	Entries []*PortfolioEntry
+	// Sum of the entries' fiat values per currency.
+	Total FiatValues
+	// Tokens whose balance could not be fetched.
+	Failed []*token.Token
+	// Number of hidden tokens flagged as spam.
+	Spam int
+}
+
+type portfolioToken struct {
+	token        *token.Token
+	transfers    int
+	lastTransfer time.Time
+	legitimate   bool
+	suspicious   bool
+}
+
+// Portfolio returns current balances of ETH, tokens tracked by the config and every token the account has transferred.
+// Zero balances, blocklisted tokens and tokens known only from suspicious transfers are left out.
+func (app *App) Portfolio(ctx context.Context, addr common.Address) *Portfolio {
+	tokens := map[common.Address]*portfolioToken{
+		token.ETHToken.Address: {token: token.ETHToken, legitimate: true},
+	}
+	for _, tokenAddr := range trackedTokenAddresses(app.Config()) {
+		if t, err := app.tokensManager.GetToken(ctx, tokenAddr); err == nil {
+			tokens[tokenAddr] = &portfolioToken{token: t, legitimate: true}
+		}
+	}
+	entries, err := app.accountTokens.List(addr)
+	if err != nil {
+		log.Printf("Failed to read tokens of %s: %v", app.Accounts().Lookup(addr), err)
+	}
+	for _, entry := range entries {
+		pt, has := tokens[entry.Token.Address]
+		if !has {
+			pt = &portfolioToken{token: entry.Token}
+			// Token details may have been registered since the transfer.
+			known, err := app.tokensManager.GetToken(ctx, entry.Token.Address)
+			if err == token.ErrBlocked {
+				continue
+			}
+			if err == nil {
+				pt.token = known
+			}
+			tokens[entry.Token.Address] = pt
+		}
+		pt.transfers = entry.Transfers
+		pt.lastTransfer = entry.LastTransfer
+		pt.legitimate = pt.legitimate || entry.Legitimate
+		pt.suspicious = entry.Suspicious
+	}
+
+	portfolio := &Portfolio{Account: addr}
+	spam := app.Spam()
+	var candidates []*portfolioToken
+	var requests []token.BalanceRequest
+	for _, pt := range tokens {
+		if (pt.suspicious && !pt.legitimate) || spam.SuspiciousToken(pt.token) {
+			portfolio.Spam++
+			continue
+		}
+		candidates = append(candidates, pt)
+		requests = append(requests, token.BalanceRequest{Token: pt.token, Addr: addr})
+	}
+
+	valuation := app.Valuation()
+	for i, r := range app.tokensManager.FetchBalances(ctx, requests, nil) {
+		pt := candidates[i]
+		if r.Err != nil {
+			log.Printf("Failed to fetch %s balance of %s: %v", pt.token.Symbol, app.Accounts().Lookup(addr), r.Err)
+			portfolio.Failed = append(portfolio.Failed, pt.token)
+			continue
+		}
+		if r.Value.Sign() == 0 {
+			continue
+		}
+		entry := &PortfolioEntry{
+			Token:        pt.token,
+			Balance:      r.Value,
+			Fiat:         valuation.Values(ctx, pt.token, r.Value),
+			Transfers:    pt.transfers,
+			LastTransfer: pt.lastTransfer,
+		}
+		for currency, value := range entry.Fiat {
+			if portfolio.Total == nil {
+				portfolio.Total = make(FiatValues)
+			}
+			if portfolio.Total[currency] == nil {
+				portfolio.Total[currency] = new(big.Rat)
+			}
+			portfolio.Total[currency].Add(portfolio.Total[currency], value)
+		}
+		portfolio.Entries = append(portfolio.Entries, entry)
+	}
+
+	sortPortfolio(portfolio.Entries, valuation.Currencies())
+	sort.Slice(portfolio.Failed, func(i, j int) bool {
+		return portfolio.Failed[i].Symbol < portfolio.Failed[j].Symbol
+	})
+	return portfolio
+}
+
+// Sorts entries by value in the first currency, the most valuable first.
+// Entries without value follow by symbol, ETH first.
+func sortPortfolio(entries []*PortfolioEntry, currencies []string) {
+	var currency string
+	if len(currencies) > 0 {
+		currency = currencies[0]
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Fiat[currency], entries[j].Fiat[currency]
+		switch {
+		case a != nil && b != nil:
+			if cmp := a.Cmp(b); cmp != 0 {
+				return cmp > 0
+			}
+		case a != nil || b != nil:
+			return a != nil
+		}
+		ai, bi := entries[i].Token.Address == token.ETHToken.Address, entries[j].Token.Address == token.ETHToken.Address
+		if ai != bi {
+			return ai
+		}
+		return entries[i].Token.Symbol < entries[j].Token.Symbol
+	})
+}
+
+// Lines renders the portfolio for text channels, the first line is the account name.
+func (p *Portfolio) Lines(name string, format token.Format) []string {
+	lines := []string{name + ":"}
+	if len(p.Entries) == 0 && len(p.Failed) == 0 {
+		lines = append(lines, "  no tokens")
+	}
+	for _, entry := range p.Entries {
+		value := entry.Token.FormatValue(entry.Balance, format)
+		if len(entry.Fiat) > 0 {
+			value += " (≈ " + entry.Fiat.String() + ")"
+		}
+		lines = append(lines, "  "+value)
+	}
+	for _, t := range p.Failed {
+		lines = append(lines, "  "+t.Symbol+": N/A")
+	}
+	if len(p.Total) > 0 {
+		lines = append(lines, "  Total: ≈ "+p.Total.String())
+	}
+	if p.Spam > 0 {
+		lines = append(lines, fmt.Sprintf("  %d spam token(s) hidden", p.Spam))
+	}
+	return lines
+}
@@ -0,0 +1,171 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultHTTPUrl      = "https://api.coingecko.com/api/v3"
+	DefaultHTTPPlatform = "ethereum"
+	DefaultHTTPCoin     = "ethereum"
+	DefaultHTTPCacheTTL = 5 * time.Minute
+	DefaultHTTPTimeout  = 10 * time.Second
+	// How long failed requests are remembered, so an unavailable API doesn't slow down every transfer.
+	HTTPErrorCacheTTL = time.Minute
+)
+
+type HTTPConfig struct {
+	// Base URL of a CoinGecko compatible API.
+	Url string
+	// Sent in the ApiKeyHeader header if set.
+	ApiKey       string
+	ApiKeyHeader string
+	// Asset platform of token contracts and coin id of ether.
+	Platform string
+	Coin     string
+	// Currencies fetched with each request, e.g. USD and EUR.
+	Currencies []string
+	CacheTTL   time.Duration
+}
+
+type cachedPrices struct {
+	// Prices per upper-cased currency, empty for unknown tokens.
+	prices  map[string]*big.Rat
+	err     error
+	expires time.Time
+}
+
+type httpSource struct {
+	config  HTTPConfig
+	client  *http.Client
+	lookups singleflight.Group
+
+	mu    sync.Mutex
+	cache map[common.Address]*cachedPrices
+}
+
+// NewHTTP returns a source fetching prices from a CoinGecko compatible API.
+// Prices of all configured currencies are fetched at once and cached for CacheTTL,
+// unknown tokens are cached too. Failed requests are cached for HTTPErrorCacheTTL.
+func NewHTTP(config HTTPConfig) Source {
+	if config.Url == "" {
+		config.Url = DefaultHTTPUrl
+	}
+	if config.Platform == "" {
+		config.Platform = DefaultHTTPPlatform
+	}
+	if config.Coin == "" {
+		config.Coin = DefaultHTTPCoin
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = DefaultHTTPCacheTTL
+	}
+	return &httpSource{
+		config: config,
+		client: &http.Client{Timeout: DefaultHTTPTimeout},
+		cache:  make(map[common.Address]*cachedPrices),
+	}
+}
+
+func (s *httpSource) Price(ctx context.Context, t *token.Token, currency string) (*big.Rat, error) {
+	prices, err := s.prices(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	price, has := prices[strings.ToUpper(currency)]
+	if !has {
+		return nil, ErrNoPrice
+	}
+	return price, nil
+}
+
+func (s *httpSource) prices(ctx context.Context, t *token.Token) (map[string]*big.Rat, error) {
+	s.mu.Lock()
+	cached, has := s.cache[t.Address]
+	s.mu.Unlock()
+	if has && time.Now().Before(cached.expires) {
+		return cached.prices, cached.err
+	}
+
+	// Concurrent lookups of the same token share a single request.
+	v, err, _ := s.lookups.Do(t.Address.Hex(), func() (interface{}, error) {
+		prices, err := s.fetch(ctx, t)
+		// Canceled lookups say nothing about the API.
+		if ctx.Err() == nil {
+			ttl := s.config.CacheTTL
+			if err != nil {
+				ttl = HTTPErrorCacheTTL
+			}
+			s.mu.Lock()
+			s.cache[t.Address] = &cachedPrices{prices: prices, err: err, expires: time.Now().Add(ttl)}
+			s.mu.Unlock()
+		}
+		return prices, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]*big.Rat), nil
+}
+
+func (s *httpSource) fetch(ctx context.Context, t *token.Token) (map[string]*big.Rat, error) {
+	currencies := make([]string, 0, len(s.config.Currencies))
+	for _, currency := range s.config.Currencies {
+		currencies = append(currencies, strings.ToLower(currency))
+	}
+	query := url.Values{"vs_currencies": {strings.Join(currencies, ",")}}
+
+	endpoint, id := "/simple/price", s.config.Coin
+	if t.Address != token.ETHToken.Address {
+		endpoint, id = "/simple/token_price/"+url.PathEscape(s.config.Platform), strings.ToLower(t.Address.Hex())
+		query.Set("contract_addresses", id)
+	} else {
+		query.Set("ids", id)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.config.Url, "/")+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.config.ApiKey != "" && s.config.ApiKeyHeader != "" {
+		req.Header.Set(s.config.ApiKeyHeader, s.config.ApiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	var body map[string]map[string]json.Number
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode prices: %w", err)
+	}
+
+	prices := make(map[string]*big.Rat)
+	for currency, value := range body[id] {
+		price, ok := new(big.Rat).SetString(value.String())
+		if !ok {
+			return nil, fmt.Errorf("invalid %s price %q", currency, value)
+		}
+		prices[strings.ToUpper(currency)] = price
+	}
+	return prices, nil
+}
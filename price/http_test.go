@@ -0,0 +1,106 @@
+package price
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestHTTP(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if got := r.Header.Get("x-api-key"); got != "key" {
+			t.Errorf("api key header = %q", got)
+		}
+		if got := r.URL.Query().Get("vs_currencies"); got != "usd,eur" {
+			t.Errorf("vs_currencies = %q", got)
+		}
+		switch r.URL.Path {
+		case "/simple/price":
+			w.Write([]byte(`{"ethereum": {"usd": 3000.5, "eur": 2750}}`))
+		case "/simple/token_price/ethereum":
+			if r.URL.Query().Get("contract_addresses") == "0xdac17f958d2ee523a2206206994597c13d831ec7" {
+				w.Write([]byte(`{"0xdac17f958d2ee523a2206206994597c13d831ec7": {"usd": 1.001}}`))
+			} else {
+				w.Write([]byte(`{}`))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := NewHTTP(HTTPConfig{
+		Url:          server.URL,
+		ApiKey:       "key",
+		ApiKeyHeader: "x-api-key",
+		Currencies:   []string{"USD", "EUR"},
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		token    *token.Token
+		currency string
+		want     *big.Rat
+	}{
+		{token.ETHToken, "USD", big.NewRat(6001, 2)},
+		{token.ETHToken, "eur", big.NewRat(2750, 1)},
+		{testUSDT, "USD", big.NewRat(1001, 1000)},
+		{testUSDT, "EUR", nil},
+		{&token.Token{Address: common.HexToAddress("0x01")}, "USD", nil},
+	}
+	for _, tt := range tests {
+		price, err := source.Price(ctx, tt.token, tt.currency)
+		if tt.want == nil {
+			if err != ErrNoPrice {
+				t.Errorf("%s/%s: got %v, %v, want ErrNoPrice", tt.token.Address.Hex(), tt.currency, price, err)
+			}
+			continue
+		}
+		if err != nil || price.Cmp(tt.want) != 0 {
+			t.Errorf("%s/%s: got %v, %v, want %s", tt.token.Address.Hex(), tt.currency, price, err, tt.want)
+		}
+	}
+	// One request per token, currencies and unknown tokens are cached.
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Errorf("%d requests, want 3", got)
+	}
+}
+
+func TestHTTPCachesErrors(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	source := NewHTTP(HTTPConfig{Url: server.URL, Currencies: []string{"USD"}})
+	done := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := source.Price(context.Background(), token.ETHToken, "USD")
+			done <- err
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := <-done; err == nil || err == ErrNoPrice {
+			t.Errorf("got %v, want request error", err)
+		}
+	}
+	if _, err := source.Price(context.Background(), token.ETHToken, "USD"); err == nil {
+		t.Error("cached error is not returned")
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("%d requests, want 1", got)
+	}
+}
@@ -0,0 +1,382 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/price/chainlink"
+	"github.com/andrei-toptal/eth-listener/price/uniswapv2"
+	"github.com/andrei-toptal/eth-listener/price/uniswapv3"
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/andrei-toptal/eth-listener/token/erc20"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	FeedChainlink = "chainlink"
+	FeedUniswapV2 = "uniswap-v2"
+	FeedUniswapV3 = "uniswap-v3"
+
+	// Max number of quote tokens followed to get to a fiat price, e.g. UNI -> WETH -> USD.
+	maxQuoteDepth = 3
+
+	// Max age of Chainlink answers at the priced block, longer than the 24h heartbeat of most feeds.
+	DefaultChainlinkMaxAge = 25 * time.Hour
+)
+
+// Feed is an on-chain price feed of a token.
+type Feed struct {
+	// Priced token, token.ETHToken.Address for ether.
+	Token common.Address
+	// One of FeedChainlink, FeedUniswapV2 or FeedUniswapV3.
+	Kind string
+	// Aggregator or pool contract address.
+	Address common.Address
+	// Feed answers are either in a fiat currency (Chainlink USD feeds)
+	// or in another token, whose price is then looked up by its own feed.
+	// Pools quote in the other pool token unless QuoteToken is set,
+	// e.g. to the ether address for WETH pools.
+	QuoteCurrency string
+	QuoteToken    *common.Address
+	// Pool token standing for Token, e.g. WETH when pricing ether, Token by default.
+	PoolToken *common.Address
+	// Chainlink answers updated longer ago are rejected, DefaultChainlinkMaxAge by default.
+	MaxAge time.Duration
+}
+
+func (f *Feed) poolToken() common.Address {
+	if f.PoolToken != nil {
+		return *f.PoolToken
+	}
+	return f.Token
+}
+
+// Pools can price both of their tokens, so feeds are identified by the contract and the token.
+type feedKey struct {
+	address common.Address
+	token   common.Address
+}
+
+type Backend interface {
+	bind.ContractCaller
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+type blockKey struct{}
+
+// WithBlock returns a context making on-chain sources read prices at the given block.
+func WithBlock(ctx context.Context, number uint64) context.Context {
+	return context.WithValue(ctx, blockKey{}, number)
+}
+
+type feedPrice struct {
+	block uint64
+	price *big.Rat
+	quote *common.Address
+}
+
+// Pool tokens never change, so they are fetched once per pool.
+type poolTokens struct {
+	token0, token1       common.Address
+	decimals0, decimals1 uint8
+}
+
+type onChain struct {
+	backend Backend
+	feeds   map[common.Address][]Feed
+
+	mu sync.Mutex
+	// Latest fetched price per feed.
+	prices map[feedKey]*feedPrice
+	pools  map[common.Address]*poolTokens
+	// Chainlink aggregator decimals.
+	decimals map[common.Address]uint8
+	// Timestamp of the latest priced block, Chainlink answers are checked against it.
+	timeBlock, timestamp uint64
+}
+
+// NewOnChain returns a source reading Chainlink aggregators and Uniswap pools.
+// Feed prices are cached per block.
+//
+// Uniswap V2 prices are spot prices of the reserves, which anyone can move within a block,
+// e.g. with a flash loan, so only deep pools should be used and preferably as a fallback.
+func NewOnChain(backend Backend, feeds []Feed) Source {
+	s := &onChain{
+		backend:  backend,
+		feeds:    make(map[common.Address][]Feed),
+		prices:   make(map[feedKey]*feedPrice),
+		pools:    make(map[common.Address]*poolTokens),
+		decimals: make(map[common.Address]uint8),
+	}
+	for _, feed := range feeds {
+		s.feeds[feed.Token] = append(s.feeds[feed.Token], feed)
+	}
+	return s
+}
+
+func (s *onChain) Price(ctx context.Context, t *token.Token, currency string) (*big.Rat, error) {
+	block, has := ctx.Value(blockKey{}).(uint64)
+	if !has {
+		var err error
+		if block, err = s.backend.BlockNumber(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return s.price(ctx, t.Address, strings.ToUpper(currency), block, 0)
+}
+
+func (s *onChain) price(ctx context.Context, addr common.Address, currency string, block uint64, depth int) (*big.Rat, error) {
+	if depth > maxQuoteDepth {
+		return nil, ErrNoPrice
+	}
+	var errs []string
+	for _, feed := range s.feeds[addr] {
+		if feed.QuoteCurrency != "" && feed.QuoteCurrency != currency {
+			continue
+		}
+		p, quote, err := s.feedPrice(ctx, feed, block)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", feed.Kind, feed.Address.Hex(), err))
+			continue
+		}
+		if quote == nil {
+			return p, nil
+		}
+		q, err := s.price(ctx, *quote, currency, block, depth+1)
+		if err != nil {
+			if !errors.Is(err, ErrNoPrice) {
+				errs = append(errs, err.Error())
+			}
+			continue
+		}
+		return new(big.Rat).Mul(p, q), nil
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPrice, strings.Join(errs, "; "))
+	}
+	return nil, ErrNoPrice
+}
+
+// Returns the feed price and the quote token, nil if the price is in fiat.
+func (s *onChain) feedPrice(ctx context.Context, feed Feed, block uint64) (*big.Rat, *common.Address, error) {
+	key := feedKey{address: feed.Address, token: feed.Token}
+	s.mu.Lock()
+	cached, has := s.prices[key]
+	s.mu.Unlock()
+	if has && cached.block == block {
+		return cached.price, cached.quote, nil
+	}
+
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	var p *big.Rat
+	var quote *common.Address
+	var err error
+	switch feed.Kind {
+	case FeedChainlink:
+		p, err = s.chainlinkPrice(opts, feed)
+		quote = feed.QuoteToken
+	case FeedUniswapV2, FeedUniswapV3:
+		p, quote, err = s.poolPrice(opts, feed)
+	default:
+		err = fmt.Errorf("unknown feed kind %q", feed.Kind)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	s.prices[key] = &feedPrice{block: block, price: p, quote: quote}
+	s.mu.Unlock()
+	return p, quote, nil
+}
+
+func (s *onChain) chainlinkPrice(opts *bind.CallOpts, feed Feed) (*big.Rat, error) {
+	aggregator, err := chainlink.NewAggregatorCaller(feed.Address, s.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	decimals, has := s.decimals[feed.Address]
+	s.mu.Unlock()
+	if !has {
+		if decimals, err = aggregator.Decimals(opts); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.decimals[feed.Address] = decimals
+		s.mu.Unlock()
+	}
+
+	round, err := aggregator.LatestRoundData(opts)
+	if err != nil {
+		return nil, err
+	}
+	blockTime, err := s.blockTime(opts.Context, opts.BlockNumber.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	maxAge := feed.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultChainlinkMaxAge
+	}
+	return chainlinkAnswer(round.RoundId, round.Answer, round.UpdatedAt, round.AnsweredInRound, decimals, blockTime, maxAge)
+}
+
+func (s *onChain) blockTime(ctx context.Context, block uint64) (uint64, error) {
+	s.mu.Lock()
+	cached, timestamp := s.timeBlock, s.timestamp
+	s.mu.Unlock()
+	if cached == block && timestamp != 0 {
+		return timestamp, nil
+	}
+	header, err := s.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	s.timeBlock, s.timestamp = block, header.Time
+	s.mu.Unlock()
+	return header.Time, nil
+}
+
+// Validates the latest round of a Chainlink aggregator read at a block with the given timestamp,
+// returns the answer scaled by the aggregator decimals.
+func chainlinkAnswer(roundId, answer, updatedAt, answeredInRound *big.Int, decimals uint8, blockTime uint64, maxAge time.Duration) (*big.Rat, error) {
+	if answer.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid answer %s", answer)
+	}
+	if updatedAt.Sign() == 0 {
+		return nil, errors.New("round is not complete")
+	}
+	if answeredInRound.Cmp(roundId) < 0 {
+		return nil, fmt.Errorf("stale answer of round %s in round %s", answeredInRound, roundId)
+	}
+	if updatedAt.IsUint64() && updatedAt.Uint64() < blockTime {
+		if age := time.Duration(blockTime-updatedAt.Uint64()) * time.Second; age > maxAge {
+			return nil, fmt.Errorf("answer is %s old, more than %s", age, maxAge)
+		}
+	}
+	return new(big.Rat).SetFrac(answer, pow10(decimals)), nil
+}
+
+func (s *onChain) poolPrice(opts *bind.CallOpts, feed Feed) (*big.Rat, *common.Address, error) {
+	pool, err := s.poolTokens(opts, feed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Price of token0 in token1.
+	var p *big.Rat
+	if feed.Kind == FeedUniswapV2 {
+		pair, err := uniswapv2.NewPairCaller(feed.Address, s.backend)
+		if err != nil {
+			return nil, nil, err
+		}
+		reserves, err := pair.GetReserves(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p, err = v2Price(reserves.Reserve0, reserves.Reserve1, pool.decimals0, pool.decimals1); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		v3pool, err := uniswapv3.NewPoolCaller(feed.Address, s.backend)
+		if err != nil {
+			return nil, nil, err
+		}
+		slot0, err := v3pool.Slot0(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p, err = v3Price(slot0.SqrtPriceX96, pool.decimals0, pool.decimals1); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	quote := pool.token1
+	if feed.poolToken() == pool.token1 {
+		p.Inv(p)
+		quote = pool.token0
+	}
+	if feed.QuoteToken != nil {
+		quote = *feed.QuoteToken
+	}
+	return p, &quote, nil
+}
+
+// Returns the price of a whole token0 in token1 given Uniswap V2 pair reserves.
+func v2Price(reserve0, reserve1 *big.Int, decimals0, decimals1 uint8) (*big.Rat, error) {
+	if reserve0.Sign() == 0 || reserve1.Sign() == 0 {
+		return nil, errors.New("empty pool reserves")
+	}
+	p := new(big.Rat).SetFrac(reserve1, reserve0)
+	return p.Mul(p, new(big.Rat).SetFrac(pow10(decimals0), pow10(decimals1))), nil
+}
+
+// Returns the price of a whole token0 in token1 given the Uniswap V3 pool sqrtPriceX96.
+func v3Price(sqrtPriceX96 *big.Int, decimals0, decimals1 uint8) (*big.Rat, error) {
+	if sqrtPriceX96.Sign() == 0 {
+		return nil, errors.New("pool is not initialized")
+	}
+	// price = (sqrtPriceX96 / 2^96)^2
+	sqrtPrice := new(big.Int).Mul(sqrtPriceX96, sqrtPriceX96)
+	p := new(big.Rat).SetFrac(sqrtPrice, new(big.Int).Lsh(big.NewInt(1), 192))
+	return p.Mul(p, new(big.Rat).SetFrac(pow10(decimals0), pow10(decimals1))), nil
+}
+
+func (s *onChain) poolTokens(opts *bind.CallOpts, feed Feed) (*poolTokens, error) {
+	s.mu.Lock()
+	pool, has := s.pools[feed.Address]
+	s.mu.Unlock()
+	if has {
+		return pool, nil
+	}
+
+	// Both pool versions have the same token0() and token1() signatures.
+	caller, err := uniswapv2.NewPairCaller(feed.Address, s.backend)
+	if err != nil {
+		return nil, err
+	}
+	pool = &poolTokens{}
+	if pool.token0, err = caller.Token0(opts); err != nil {
+		return nil, err
+	}
+	if pool.token1, err = caller.Token1(opts); err != nil {
+		return nil, err
+	}
+	if side := feed.poolToken(); side != pool.token0 && side != pool.token1 {
+		return nil, fmt.Errorf("pool does not contain token %s", side.Hex())
+	}
+	if pool.decimals0, err = s.tokenDecimals(opts, pool.token0); err != nil {
+		return nil, err
+	}
+	if pool.decimals1, err = s.tokenDecimals(opts, pool.token1); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.pools[feed.Address] = pool
+	s.mu.Unlock()
+	return pool, nil
+}
+
+func (s *onChain) tokenDecimals(opts *bind.CallOpts, addr common.Address) (uint8, error) {
+	t, err := erc20.NewERC20Caller(addr, s.backend)
+	if err != nil {
+		return 0, err
+	}
+	return t.Decimals(opts)
+}
+
+func pow10(n uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,74 @@
+package price
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestChainlinkAnswer(t *testing.T) {
+	const blockTime = 1_700_000_000
+	tests := []struct {
+		name                                        string
+		roundId, answer, updatedAt, answeredInRound int64
+		want                                        *big.Rat
+	}{
+		{"fresh", 10, 300_050_000_000, blockTime - 3600, 10, big.NewRat(600_100, 200)},
+		{"updated after the block", 10, 300_000_000_000, blockTime + 12, 10, big.NewRat(3000, 1)},
+		{"zero answer", 10, 0, blockTime, 10, nil},
+		{"negative answer", 10, -1, blockTime, 10, nil},
+		{"incomplete round", 10, 300_000_000_000, 0, 10, nil},
+		{"answered in an earlier round", 10, 300_000_000_000, blockTime, 9, nil},
+		{"older than max age", 10, 300_000_000_000, blockTime - 2*3600 - 1, 10, nil},
+	}
+	for _, tt := range tests {
+		got, err := chainlinkAnswer(big.NewInt(tt.roundId), big.NewInt(tt.answer), big.NewInt(tt.updatedAt), big.NewInt(tt.answeredInRound), 8, blockTime, 2*time.Hour)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: got %s, want error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got.Cmp(tt.want) != 0 {
+			t.Errorf("%s: got %v, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestV2Price(t *testing.T) {
+	// 30M USDC (6 decimals) against 10K WETH (18 decimals).
+	reserve0, _ := new(big.Int).SetString("30000000000000", 10)
+	reserve1, _ := new(big.Int).SetString("10000000000000000000000", 10)
+	p, err := v2Price(reserve0, reserve1, 6, 18)
+	if err != nil || p.Cmp(big.NewRat(1, 3000)) != 0 {
+		t.Errorf("got %v, %v, want 1/3000", p, err)
+	}
+	if _, err := v2Price(big.NewInt(0), reserve1, 6, 18); err == nil {
+		t.Error("empty reserves are priced")
+	}
+}
+
+func TestV3Price(t *testing.T) {
+	q96 := new(big.Int).Lsh(big.NewInt(1), 96)
+	tests := []struct {
+		sqrtPriceX96         *big.Int
+		decimals0, decimals1 uint8
+		want                 *big.Rat
+	}{
+		{q96, 18, 18, big.NewRat(1, 1)},
+		{new(big.Int).Mul(q96, big.NewInt(2)), 18, 18, big.NewRat(4, 1)},
+		{new(big.Int).Div(q96, big.NewInt(2)), 18, 18, big.NewRat(1, 4)},
+		// Raw price 1 of a 6 decimals token0 in an 18 decimals token1.
+		{q96, 6, 18, new(big.Rat).SetFrac(big.NewInt(1), pow10(12))},
+		{new(big.Int).Mul(q96, big.NewInt(1000)), 6, 12, big.NewRat(1, 1)},
+	}
+	for _, tt := range tests {
+		p, err := v3Price(tt.sqrtPriceX96, tt.decimals0, tt.decimals1)
+		if err != nil || p.Cmp(tt.want) != 0 {
+			t.Errorf("v3Price(%s, %d, %d) = %v, %v, want %s", tt.sqrtPriceX96, tt.decimals0, tt.decimals1, p, err, tt.want)
+		}
+	}
+	if _, err := v3Price(big.NewInt(0), 18, 18); err == nil {
+		t.Error("uninitialized pool is priced")
+	}
+}
@@ -0,0 +1,54 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/andrei-toptal/eth-listener/token"
+)
+
+// Returned by sources which don't know the price of the token.
+var ErrNoPrice = errors.New("no price")
+
+type Source interface {
+	// Returns price of one whole token (not its smallest unit) in the given currency, e.g. "USD",
+	// or ErrNoPrice if the token or currency is unknown to the source.
+	Price(ctx context.Context, t *token.Token, currency string) (*big.Rat, error)
+}
+
+type chain []Source
+
+// NewChain returns a source asking the given sources in order until one knows the price.
+func NewChain(sources ...Source) Source {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	return chain(sources)
+}
+
+func (c chain) Price(ctx context.Context, t *token.Token, currency string) (*big.Rat, error) {
+	var errs []string
+	for _, source := range c {
+		price, err := source.Price(ctx, t, currency)
+		if err == nil {
+			return price, nil
+		}
+		if !errors.Is(err, ErrNoPrice) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPrice, strings.Join(errs, "; "))
+	}
+	return nil, ErrNoPrice
+}
+
+// Value returns the value of amount token units given the price of one whole token.
+func Value(t *token.Token, amount *big.Int, price *big.Rat) *big.Rat {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(t.Decimals)), nil)
+	value := new(big.Rat).SetFrac(amount, unit)
+	return value.Mul(value, price)
+}
@@ -0,0 +1,75 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+type static struct {
+	// Prices per token address and upper-cased currency.
+	prices map[common.Address]map[string]*big.Rat
+}
+
+// NewStatic returns a source with fixed prices, e.g. for offline use and tests.
+// Keys are "ETH" or token contract addresses; symbols are not accepted
+// since any contract can claim any symbol.
+func NewStatic(prices map[string]map[string]string) (Source, error) {
+	s := &static{
+		prices: make(map[common.Address]map[string]*big.Rat),
+	}
+	for key, currencies := range prices {
+		var addr common.Address
+		switch {
+		case strings.EqualFold(key, token.ETHToken.Symbol):
+			addr = token.ETHToken.Address
+		case common.IsHexAddress(key):
+			addr = common.HexToAddress(key)
+		default:
+			return nil, fmt.Errorf("%q is neither ETH nor a token address", key)
+		}
+		s.prices[addr] = make(map[string]*big.Rat)
+		for currency, value := range currencies {
+			price, ok := new(big.Rat).SetString(value)
+			if !ok || price.Sign() < 0 {
+				return nil, fmt.Errorf("%s: %q is not a valid %s price", key, value, currency)
+			}
+			s.prices[addr][strings.ToUpper(currency)] = price
+		}
+	}
+	return s, nil
+}
+
+// NewStaticFile reads static prices from a YAML file like:
+//
+//	ETH: {USD: "3000", EUR: "2750"}
+//	"0xdAC17F958D2ee523a2206206994597C13D831ec7": {USD: "1"}
+func NewStaticFile(path string) (Source, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices map[string]map[string]string
+	if err := yaml.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	source, err := NewStatic(prices)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return source, nil
+}
+
+func (s *static) Price(ctx context.Context, t *token.Token, currency string) (*big.Rat, error) {
+	price, has := s.prices[t.Address][strings.ToUpper(currency)]
+	if !has {
+		return nil, ErrNoPrice
+	}
+	return price, nil
+}
@@ -0,0 +1,98 @@
+package price
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var testUSDT = &token.Token{Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), Symbol: "USDT", Decimals: 6}
+
+func TestStatic(t *testing.T) {
+	source, err := NewStatic(map[string]map[string]string{
+		"eth":                  {"usd": "3000.5", "EUR": "2750"},
+		testUSDT.Address.Hex(): {"USD": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		token    *token.Token
+		currency string
+		want     string
+	}{
+		{token.ETHToken, "USD", "6001/2"},
+		{token.ETHToken, "eur", "2750/1"},
+		{testUSDT, "usd", "1/1"},
+		{testUSDT, "EUR", ""},
+		{&token.Token{Address: common.HexToAddress("0x01"), Symbol: "USDT"}, "USD", ""},
+	}
+	for _, tt := range tests {
+		price, err := source.Price(context.Background(), tt.token, tt.currency)
+		if tt.want == "" {
+			if err != ErrNoPrice {
+				t.Errorf("%s/%s: got %v, %v, want ErrNoPrice", tt.token.Symbol, tt.currency, price, err)
+			}
+			continue
+		}
+		if err != nil || price.String() != tt.want {
+			t.Errorf("%s/%s: got %v, %v, want %s", tt.token.Symbol, tt.currency, price, err, tt.want)
+		}
+	}
+}
+
+func TestStaticInvalid(t *testing.T) {
+	for _, prices := range []map[string]map[string]string{
+		{"USDT": {"USD": "1"}},
+		{"ETH": {"USD": "abc"}},
+		{"ETH": {"USD": "-1"}},
+	} {
+		if _, err := NewStatic(prices); err == nil {
+			t.Errorf("%v: no error", prices)
+		}
+	}
+}
+
+func TestStaticFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.yaml")
+	if err := os.WriteFile(path, []byte("ETH: {USD: \"3000\"}\n\"0xdAC17F958D2ee523a2206206994597C13D831ec7\": {USD: \"1\"}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewStaticFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price, err := source.Price(context.Background(), testUSDT, "USD"); err != nil || price.Cmp(big.NewRat(1, 1)) != 0 {
+		t.Errorf("got %v, %v", price, err)
+	}
+}
+
+func TestValue(t *testing.T) {
+	// 2.5 USDT at 1.2 USD.
+	value := Value(testUSDT, big.NewInt(2_500_000), big.NewRat(6, 5))
+	if value.Cmp(big.NewRat(3, 1)) != 0 {
+		t.Errorf("got %s, want 3", value)
+	}
+}
+
+func TestChain(t *testing.T) {
+	first, _ := NewStatic(map[string]map[string]string{"ETH": {"USD": "3000"}})
+	second, _ := NewStatic(map[string]map[string]string{"ETH": {"EUR": "2750"}, testUSDT.Address.Hex(): {"USD": "1"}})
+	source := NewChain(first, second)
+
+	if price, err := source.Price(context.Background(), token.ETHToken, "USD"); err != nil || price.Cmp(big.NewRat(3000, 1)) != 0 {
+		t.Errorf("ETH/USD: got %v, %v", price, err)
+	}
+	if price, err := source.Price(context.Background(), token.ETHToken, "EUR"); err != nil || price.Cmp(big.NewRat(2750, 1)) != 0 {
+		t.Errorf("ETH/EUR: got %v, %v", price, err)
+	}
+	if _, err := source.Price(context.Background(), testUSDT, "EUR"); err != ErrNoPrice {
+		t.Errorf("USDT/EUR: got %v, want ErrNoPrice", err)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/price"
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	PriceSourceStatic  = "static"
+	PriceSourceHTTP    = "http"
+	PriceSourceOnChain = "onchain"
+)
+
+// PriceFeedConfig maps a token to an on-chain price feed.
+type PriceFeedConfig struct {
+	// Priced token, ETH or a contract address.
+	Token string `yaml:"token"`
+	// Exactly one feed contract address.
+	Chainlink string `yaml:"chainlink"`
+	UniswapV2 string `yaml:"uniswap-v2"`
+	UniswapV3 string `yaml:"uniswap-v3"`
+	// Fiat currency (e.g. USD) or token (ETH or address) the feed price is in.
+	// Chainlink feeds are in USD by default, pools in the other pool token.
+	Quote string `yaml:"quote"`
+	// Pool token standing for the priced token, e.g. WETH when pricing ETH.
+	PoolToken string `yaml:"pool-token"`
+	// Chainlink answers updated longer ago than this at the priced block are rejected, 25h by default.
+	MaxAge time.Duration `yaml:"max-age"`
+}
+
+type PriceSourceConfig struct {
+	// Either "static", "http" or "onchain".
+	Type string `yaml:"type"`
+	// Static prices file, see price.NewStaticFile.
+	File string `yaml:"file"`
+	// CoinGecko compatible API, public CoinGecko API by default.
+	Url          string        `yaml:"url"`
+	ApiKey       string        `yaml:"api-key"`
+	ApiKeyHeader string        `yaml:"api-key-header"`
+	CacheTTL     time.Duration `yaml:"cache-ttl"`
+	// On-chain feeds read through the eth-url node.
+	Feeds []PriceFeedConfig `yaml:"feeds"`
+}
+
+type PricesConfig struct {
+	// Fiat currencies to value transfers and balances in, USD by default.
+	Currencies []string `yaml:"currencies"`
+	// Asked in order until one knows the price.
+	Sources []PriceSourceConfig `yaml:"sources"`
+}
+
+// FiatValues are values per currency, e.g. "USD".
+type FiatValues map[string]*big.Rat
+
+func (f FiatValues) Currencies() []string {
+	currencies := make([]string, 0, len(f))
+	for currency := range f {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// Get returns the value rounded to cents, empty if the value is unknown.
+func (f FiatValues) Get(currency string) string {
+	value, has := f[strings.ToUpper(currency)]
+	if !has {
+		return ""
+	}
+	return value.FloatString(2)
+}
+
+// Strings returns values rounded to cents per currency, nil if there are none.
+func (f FiatValues) Strings() map[string]string {
+	if len(f) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(f))
+	for currency := range f {
+		values[currency] = f.Get(currency)
+	}
+	return values
+}
+
+// String renders all values like "1523.44 USD, 1401.56 EUR".
+func (f FiatValues) String() string {
+	values := make([]string, 0, len(f))
+	for _, currency := range f.Currencies() {
+		values = append(values, f.Get(currency)+" "+currency)
+	}
+	return strings.Join(values, ", ")
+}
+
+// Valuation values token amounts in fiat currencies.
+type Valuation struct {
+	source     price.Source
+	currencies []string
+}
+
+// Parses "ETH" or a token contract address.
+func parseTokenAddress(ref string) (common.Address, error) {
+	if strings.EqualFold(ref, token.ETHToken.Symbol) {
+		return token.ETHToken.Address, nil
+	}
+	if err := validateAddress(ref); err != nil {
+		return common.Address{}, fmt.Errorf("%q %v", ref, err)
+	}
+	return common.HexToAddress(ref), nil
+}
+
+func parsePriceFeed(fc PriceFeedConfig) (price.Feed, error) {
+	feed := price.Feed{}
+	var err error
+	if feed.Token, err = parseTokenAddress(fc.Token); err != nil {
+		return feed, fmt.Errorf("token: %w", err)
+	}
+
+	var contracts []string
+	for kind, addr := range map[string]string{
+		price.FeedChainlink: fc.Chainlink,
+		price.FeedUniswapV2: fc.UniswapV2,
+		price.FeedUniswapV3: fc.UniswapV3,
+	} {
+		if addr == "" {
+			continue
+		}
+		contracts = append(contracts, kind)
+		if err := validateAddress(addr); err != nil {
+			return feed, fmt.Errorf("%s: %q %v", kind, addr, err)
+		}
+		feed.Kind, feed.Address = kind, common.HexToAddress(addr)
+	}
+	if len(contracts) != 1 {
+		return feed, fmt.Errorf("exactly one of %s, %s or %s is required", price.FeedChainlink, price.FeedUniswapV2, price.FeedUniswapV3)
+	}
+
+	switch {
+	case fc.Quote == "" && feed.Kind == price.FeedChainlink:
+		feed.QuoteCurrency = DefaultFiatCurrency
+	case fc.Quote == "":
+	case len(fc.Quote) == 3 && !strings.EqualFold(fc.Quote, token.ETHToken.Symbol):
+		feed.QuoteCurrency = strings.ToUpper(fc.Quote)
+	default:
+		quote, err := parseTokenAddress(fc.Quote)
+		if err != nil {
+			return feed, fmt.Errorf("quote: %w", err)
+		}
+		feed.QuoteToken = &quote
+	}
+
+	if fc.PoolToken != "" {
+		if feed.Kind == price.FeedChainlink {
+			return feed, fmt.Errorf("pool-token is only supported by pools")
+		}
+		poolToken, err := parseTokenAddress(fc.PoolToken)
+		if err != nil {
+			return feed, fmt.Errorf("pool-token: %w", err)
+		}
+		feed.PoolToken = &poolToken
+	}
+	if fc.MaxAge != 0 {
+		if feed.Kind != price.FeedChainlink {
+			return feed, fmt.Errorf("max-age is only supported by chainlink feeds")
+		}
+		if fc.MaxAge < 0 {
+			return feed, fmt.Errorf("max-age must not be negative")
+		}
+		feed.MaxAge = fc.MaxAge
+	}
+	return feed, nil
+}
+
+func newPriceSource(sc PriceSourceConfig, currencies []string, client *ethclient.Client) (price.Source, error) {
+	switch sc.Type {
+	case PriceSourceStatic:
+		return price.NewStaticFile(sc.File)
+	case PriceSourceHTTP:
+		return price.NewHTTP(price.HTTPConfig{
+			Url:          sc.Url,
+			ApiKey:       sc.ApiKey,
+			ApiKeyHeader: sc.ApiKeyHeader,
+			Currencies:   currencies,
+			CacheTTL:     sc.CacheTTL,
+		}), nil
+	case PriceSourceOnChain:
+		feeds := make([]price.Feed, 0, len(sc.Feeds))
+		for i, fc := range sc.Feeds {
+			feed, err := parsePriceFeed(fc)
+			if err != nil {
+				return nil, fmt.Errorf("feeds[%d]: %w", i, err)
+			}
+			feeds = append(feeds, feed)
+		}
+		return price.NewOnChain(client, feeds), nil
+	default:
+		return nil, fmt.Errorf("unknown price source type %q", sc.Type)
+	}
+}
+
+// Returns nil valuation if prices are not configured.
+// The client is used by on-chain price sources.
+func NewValuation(config *Config, client *ethclient.Client) (*Valuation, error) {
+	if config.Prices == nil || len(config.Prices.Sources) == 0 {
+		return nil, nil
+	}
+	v := &Valuation{
+		currencies: []string{DefaultFiatCurrency},
+	}
+	if len(config.Prices.Currencies) > 0 {
+		v.currencies = nil
+		for _, currency := range config.Prices.Currencies {
+			v.currencies = append(v.currencies, strings.ToUpper(currency))
+		}
+	}
+	sources := make([]price.Source, 0, len(config.Prices.Sources))
+	for i, sc := range config.Prices.Sources {
+		source, err := newPriceSource(sc, v.currencies, client)
+		if err != nil {
+			return nil, fmt.Errorf("prices.sources[%d]: %w", i, err)
+		}
+		sources = append(sources, source)
+	}
+	v.source = price.NewChain(sources...)
+	return v, nil
+}
+
+// Currencies returns the configured currencies, none for a nil valuation.
+func (v *Valuation) Currencies() []string {
+	if v == nil {
+		return nil
+	}
+	return v.currencies
+}
+
+// Values returns the value of amount token units in every configured currency.
+// Currencies without known price are skipped, a nil valuation returns no values.
+// On-chain sources read prices at the block set by price.WithBlock, the latest block otherwise.
+func (v *Valuation) Values(ctx context.Context, t *token.Token, amount *big.Int) FiatValues {
+	if v == nil || amount == nil {
+		return nil
+	}
+	values := make(FiatValues)
+	for _, currency := range v.currencies {
+		p, err := v.source.Price(ctx, t, currency)
+		if err != nil {
+			// Bare ErrNoPrice just means the token is unknown, anything else is worth logging.
+			if err != price.ErrNoPrice {
+				log.Printf("Failed to get %s price of %s: %v", currency, t.Symbol, err)
+			}
+			continue
+		}
+		values[currency] = price.Value(t, amount, p)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
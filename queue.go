@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+type RetryConfig struct {
+	// Number of delivery attempts before an event is dropped, 0 means default.
+	MaxAttempts    int           `yaml:"max-attempts"`
+	InitialBackoff time.Duration `yaml:"initial-backoff"`
+	MaxBackoff     time.Duration `yaml:"max-backoff"`
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return c
+}
+
+// Returns the delay before the given (1-based) retry attempt: exponential with 20% jitter.
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	d := c.InitialBackoff
+	for i := 1; i < attempt && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/5 + 1))
+	return d - d/10 + jitter
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Marks a delivery error as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return fmt.Sprintf("%v (retry after %s)", e.err, e.after) }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// Marks a delivery error as rate limited, the next attempt is made after the given delay
+// instead of the usual backoff and is counted against RetryMaxRateLimited instead of max attempts.
+func RetryAfter(err error, after time.Duration) error {
+	return &retryAfterError{err: err, after: after}
+}
+
+type queuedEvent struct {
+	Event       *Event
+	Attempts    int
+	RateLimited int
+	NextAttempt time.Time
+}
+
+var (
+	// Serializes delivery per queue name, so a queue re-created by a config reload
+	// never sends the same event twice while the old one shuts down.
+	queueLocks sync.Map
+	queueSeq   atomic.Uint64
+)
+
+type deliveryQueueConfig struct {
+	// Unique and stable across restarts, used as the Store bucket name.
+	Name  string
+	Retry RetryConfig
+	// Maximal number of events delivered at once. Events piling up during bursts
+	// or rate limiting are coalesced into a single delivery.
+	MaxBatch int
+	// Optional limit on the total Size of a batch, e.g. the message length of the service.
+	// A single event exceeding it is still delivered alone.
+	MaxSize int
+	Size    func(event *Event) int
+	// Minimal interval between deliveries.
+	Interval time.Duration
+	Send     func(ctx context.Context, events []*Event) error
+}
+
+// deliveryQueue persists events in the Store and delivers them in order
+// with retries, so pending deliveries survive restarts.
+type deliveryQueue struct {
+	config       deliveryQueueConfig
+	store        Store
+	lock         *sync.Mutex
+	lastDelivery time.Time
+	wakeCh       chan struct{}
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	// Number of next events delivered one by one, after a batch they were part of failed permanently.
+	unbatched int
+}
+
+func newDeliveryQueue(store Store, config deliveryQueueConfig) *deliveryQueue {
+	config.Retry = config.Retry.withDefaults()
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = 1
+	}
+	lock, _ := queueLocks.LoadOrStore(config.Name, &sync.Mutex{})
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &deliveryQueue{
+		config: config,
+		store:  store,
+		lock:   lock.(*sync.Mutex),
+		wakeCh: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	q.wg.Add(1)
+	go q.loop()
+	return q
+}
+
+func (q *deliveryQueue) bucket() string {
+	return "queue/" + q.config.Name
+}
+
+// Returns a key which keeps FIFO order across restarts.
+func nextQueueKey() []byte {
+	for {
+		last := queueSeq.Load()
+		seq := uint64(time.Now().UnixNano())
+		if seq <= last {
+			seq = last + 1
+		}
+		if queueSeq.CAS(last, seq) {
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			return key
+		}
+	}
+}
+
+func (q *deliveryQueue) Push(event *Event) error {
+	if err := q.store.Put(q.bucket(), nextQueueKey(), &queuedEvent{Event: event}); err != nil {
+		return err
+	}
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *deliveryQueue) Close() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Closes the queue and drops all pending events.
+func (q *deliveryQueue) Purge() error {
+	q.Close()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var keys [][]byte
+	err := q.store.ForEach(q.bucket(), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		keys = append(keys, key)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return q.delete(keys)
+}
+
+func (q *deliveryQueue) loop() {
+	defer q.wg.Done()
+
+	for {
+		wait, err := q.deliverNext()
+		if err != nil {
+			log.Printf("Delivery queue %s failed: %v", q.config.Name, err)
+			wait = q.config.Retry.InitialBackoff
+		}
+
+		var timer *time.Timer
+		var timerCh <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timerCh = timer.C
+		}
+		select {
+		case <-q.ctx.Done():
+		case <-q.wakeCh:
+		case <-timerCh:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if q.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Tries to deliver the oldest queued events.
+// Returns how long to wait before the next try, negative if the queue is empty.
+func (q *deliveryQueue) deliverNext() (time.Duration, error) {
+	if wait := time.Until(q.lastDelivery.Add(q.config.Interval)); wait > 0 {
+		return wait, nil
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	maxBatch := q.config.MaxBatch
+	if q.unbatched > 0 {
+		maxBatch = 1
+	}
+	var keys, corrupt [][]byte
+	var items []*queuedEvent
+	var wait time.Duration
+	var size int
+	now := time.Now()
+	err := q.store.ForEach(q.bucket(), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		item := &queuedEvent{}
+		if err := decode(item); err != nil {
+			// Would block the queue forever, e.g. after an incompatible Event change.
+			log.Printf("Dropping undecodable %s notification: %v", q.config.Name, err)
+			corrupt = append(corrupt, key)
+			return true, nil
+		}
+		if item.NextAttempt.After(now) {
+			if len(items) == 0 {
+				wait = item.NextAttempt.Sub(now)
+			}
+			return false, nil
+		}
+		if q.config.MaxSize > 0 {
+			size += q.config.Size(item.Event)
+			if len(items) > 0 && size > q.config.MaxSize {
+				return false, nil
+			}
+		}
+		keys = append(keys, key)
+		items = append(items, item)
+		return len(items) < maxBatch, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := q.delete(corrupt); err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		if wait > 0 {
+			return wait, nil
+		}
+		return -1, nil
+	}
+
+	events := make([]*Event, len(items))
+	for i, item := range items {
+		events[i] = item.Event
+	}
+	err = q.config.Send(q.ctx, events)
+	q.lastDelivery = time.Now()
+	if err == nil {
+		q.delivered(len(items))
+		return 0, q.delete(keys)
+	}
+	if q.ctx.Err() != nil {
+		return 0, nil
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		if len(items) > 1 {
+			// Likely caused by a single event, retry them one by one to drop only that one.
+			log.Printf("Failed to deliver %d %s notifications at once, retrying one by one: %v", len(items), q.config.Name, err)
+			q.unbatched = len(items)
+			return 0, nil
+		}
+		log.Printf("Dropping %s notification: %v", q.config.Name, err)
+		q.delivered(1)
+		return 0, q.delete(keys)
+	}
+
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		wait = retryAfter.after
+		log.Printf("Delivery of %s notifications is rate limited, retrying in %s", q.config.Name, wait)
+	} else {
+		wait = q.config.Retry.backoff(items[0].Attempts + 1)
+		log.Printf("Failed to deliver %d %s notification(s) (attempt %d), retrying in %s: %v",
+			len(items), q.config.Name, items[0].Attempts+1, wait.Round(time.Second), err)
+	}
+
+	for i, item := range items {
+		if retryAfter == nil {
+			item.Attempts++
+		} else {
+			item.RateLimited++
+		}
+		if item.Attempts >= q.config.Retry.MaxAttempts || item.RateLimited >= RetryMaxRateLimited {
+			log.Printf("Dropping %s notification after %d attempt(s): %v", q.config.Name, item.Attempts+item.RateLimited, err)
+			if err := q.store.Delete(q.bucket(), keys[i]); err != nil {
+				return 0, err
+			}
+			q.delivered(1)
+			continue
+		}
+		item.NextAttempt = time.Now().Add(wait)
+		if err := q.store.Put(q.bucket(), keys[i], item); err != nil {
+			return 0, err
+		}
+	}
+	return wait, nil
+}
+
+// Counts events leaving the queue towards the ones to deliver one by one.
+func (q *deliveryQueue) delivered(n int) {
+	if q.unbatched -= n; q.unbatched < 0 {
+		q.unbatched = 0
+	}
+}
+
+func (q *deliveryQueue) delete(keys [][]byte) error {
+	for _, key := range keys {
+		if err := q.store.Delete(q.bucket(), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
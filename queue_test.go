@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeliveryQueueDropsUndecodableItems(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewStore("store")
+	defer store.Close()
+
+	delivered := make(chan *Event, 1)
+	config := deliveryQueueConfig{
+		Name: "test",
+		Send: func(ctx context.Context, events []*Event) error {
+			delivered <- events[0]
+			return nil
+		},
+	}
+	// Queued before the queue starts, so it is the oldest item.
+	if err := store.Put("queue/"+config.Name, nextQueueKey(), "not an event"); err != nil {
+		t.Fatal(err)
+	}
+	q := newDeliveryQueue(store, config)
+	defer q.Close()
+
+	if err := q.Push(NewStatusEvent("hello")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-delivered:
+		if event.Message != "hello" {
+			t.Errorf("delivered %q", event.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue is blocked by the undecodable item")
+	}
+}
+
+// Queues the messages before the queue starts, so they are delivered in batches.
+func newTestQueue(t *testing.T, config deliveryQueueConfig, messages ...string) *deliveryQueue {
+	store := NewStore("store")
+	t.Cleanup(store.Close)
+	for _, message := range messages {
+		if err := store.Put("queue/"+config.Name, nextQueueKey(), &queuedEvent{Event: NewStatusEvent(message)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := newDeliveryQueue(store, config)
+	t.Cleanup(q.Close)
+	return q
+}
+
+func receiveBatches(t *testing.T, batches <-chan []string, n int) [][]string {
+	var got [][]string
+	for i := 0; i < n; i++ {
+		select {
+		case batch := <-batches:
+			got = append(got, batch)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %v, timed out waiting for more batches", got)
+		}
+	}
+	return got
+}
+
+func messages(events []*Event) []string {
+	texts := make([]string, len(events))
+	for i, event := range events {
+		texts[i] = event.Message
+	}
+	return texts
+}
+
+func TestDeliveryQueueRetriesFailedBatchOneByOne(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	batches := make(chan []string, 10)
+	newTestQueue(t, deliveryQueueConfig{
+		Name:     "test",
+		MaxBatch: 10,
+		Send: func(ctx context.Context, events []*Event) error {
+			batches <- messages(events)
+			for _, event := range events {
+				if event.Message == "bad" {
+					return Permanent(errors.New("bad request"))
+				}
+			}
+			return nil
+		},
+	}, "a", "bad", "b")
+
+	got := receiveBatches(t, batches, 4)
+	want := [][]string{{"a", "bad", "b"}, {"a"}, {"bad"}, {"b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got batches %v, want %v", got, want)
+	}
+}
+
+func TestDeliveryQueueMaxSize(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	batches := make(chan []string, 10)
+	newTestQueue(t, deliveryQueueConfig{
+		Name:     "test",
+		MaxBatch: 10,
+		MaxSize:  10,
+		Size: func(event *Event) int {
+			return len(event.Message)
+		},
+		Send: func(ctx context.Context, events []*Event) error {
+			batches <- messages(events)
+			return nil
+		},
+	}, "aaaa", "bbbb", "cc", "dddddddddddd", "e")
+
+	got := receiveBatches(t, batches, 3)
+	want := [][]string{{"aaaa", "bbbb", "cc"}, {"dddddddddddd"}, {"e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got batches %v, want %v", got, want)
+	}
+}
+
+func TestDeliveryQueueCapsRateLimitedAttempts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	sent := make(chan struct{}, RetryMaxRateLimited+1)
+	q := newTestQueue(t, deliveryQueueConfig{
+		Name:     "test",
+		MaxBatch: 1,
+		Send: func(ctx context.Context, events []*Event) error {
+			sent <- struct{}{}
+			return RetryAfter(errors.New("too many requests"), time.Millisecond)
+		},
+	}, "a")
+
+	for i := 0; i < RetryMaxRateLimited; i++ {
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d attempts", i)
+		}
+	}
+	select {
+	case <-sent:
+		t.Fatal("rate limited notification is retried past the cap")
+	case <-time.After(100 * time.Millisecond):
+	}
+	left := 0
+	q.store.ForEach(q.bucket(), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		left++
+		return true, nil
+	})
+	if left != 0 {
+		t.Errorf("%d notifications left in the queue", left)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+
+	RuleActionNotify   = "notify"
+	RuleActionSuppress = "suppress"
+)
+
+var severityLevels = map[string]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+// RuleConfig describes a notification rule.
+// Transfers are matched against rules in order, the first rule whose selectors
+// (accounts, direction, tokens, counterparties) match decides what happens.
+type RuleConfig struct {
+	Name string `yaml:"name"`
+
+	// Selectors, empty means any.
+	Accounts  []string `yaml:"accounts"`
+	Direction string   `yaml:"direction"`
+	// Token symbols match ether, registered and well-known tokens only, not fakes claiming the symbol.
+	Tokens         []string `yaml:"tokens"`
+	Counterparties []string `yaml:"counterparties"`
+
+	// Filters, matching transfers which don't pass them are suppressed.
+	// Token symbols match any token claiming them.
+	DenyTokens         []string `yaml:"deny-tokens"`
+	DenyCounterparties []string `yaml:"deny-counterparties"`
+	// Minimal transfer value per token symbol or address, in token units, e.g. `USDT: "100"`.
+	// Unlike in Tokens, symbols match any token claiming them, so fake tokens are not let through.
+	MinValue map[string]string `yaml:"min-value"`
+	// Minimal transfer value per fiat currency, e.g. `USD: "100"`, needs prices to be configured.
+	// Transfers of tokens without known price are not filtered by it.
+	MinFiat map[string]string `yaml:"min-fiat"`
+	// Local time range like "22:00-07:00" when only critical notifications are sent.
+	QuietHours string `yaml:"quiet-hours"`
+
+	Severity string `yaml:"severity"`
+	Action   string `yaml:"action"`
+}
+
+type RuleDecision struct {
+	Notify   bool
+	Severity string
+	// Explains why the transfer is suppressed.
+	Reason string
+}
+
+// Token reference by symbol (case-insensitive) or contract address.
+type tokenRef struct {
+	symbol  string
+	address *common.Address
+	// Addresses of the known tokens with the symbol, nil if any token claiming the symbol matches.
+	known map[common.Address]bool
+}
+
+func parseTokenRef(ref string) tokenRef {
+	if common.IsHexAddress(ref) {
+		addr := common.HexToAddress(ref)
+		return tokenRef{address: &addr}
+	}
+	return tokenRef{symbol: ref}
+}
+
+// Resolves token symbols to ether, registered tokens and well-known tokens, since any contract can claim any symbol.
+type tokenSymbols struct {
+	registry  *token.Registry
+	wellKnown map[string]common.Address
+}
+
+func newTokenSymbols(config *Config, registry *token.Registry) *tokenSymbols {
+	return &tokenSymbols{registry: registry, wellKnown: knownTokens(config)}
+}
+
+func (s *tokenSymbols) resolve(ref string) (tokenRef, error) {
+	r := parseTokenRef(ref)
+	if r.address != nil {
+		return r, nil
+	}
+	r.known = make(map[common.Address]bool)
+	if strings.EqualFold(r.symbol, token.ETHToken.Symbol) {
+		r.known[token.ETHToken.Address] = true
+	}
+	for _, addr := range s.registry.Addresses(r.symbol) {
+		r.known[addr] = true
+	}
+	for symbol, addr := range s.wellKnown {
+		if strings.EqualFold(symbol, r.symbol) {
+			r.known[addr] = true
+		}
+	}
+	if len(r.known) == 0 {
+		return r, fmt.Errorf("%q is not a known token symbol, use the contract address or add it to tokens.tracked", ref)
+	}
+	return r, nil
+}
+
+func (r tokenRef) matches(t *token.Token) bool {
+	if r.address != nil {
+		return *r.address == t.Address && t.Address != token.ETHToken.Address
+	}
+	if r.known != nil {
+		return r.known[t.Address]
+	}
+	return strings.EqualFold(r.symbol, t.Symbol)
+}
+
+type minValue struct {
+	ref   tokenRef
+	value *token.Decimal
+}
+
+type quietHours struct {
+	// Minutes since midnight.
+	from, to int
+}
+
+func parseQuietHours(s string) (*quietHours, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%q must look like 22:00-07:00", s)
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("%q must look like 22:00-07:00", s)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return &quietHours{from: minutes[0], to: minutes[1]}, nil
+}
+
+func (q *quietHours) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if q.from <= q.to {
+		return m >= q.from && m < q.to
+	}
+	return m >= q.from || m < q.to
+}
+
+type rule struct {
+	name               string
+	accounts           []common.Address
+	direction          *Direction
+	tokens             []tokenRef
+	counterparties     []common.Address
+	denyTokens         []tokenRef
+	denyCounterparties []common.Address
+	minValues          []minValue
+	minFiat            map[string]*token.Decimal
+	quietHours         *quietHours
+	severity           string
+	suppress           bool
+}
+
+// Rules decides whether and how transfers are notified.
+type Rules struct {
+	rules []*rule
+}
+
+// Resolves an account alias or any address.
+func resolveAddressRef(accounts Accounts, ref string) (common.Address, error) {
+	if common.IsHexAddress(ref) {
+		return common.HexToAddress(ref), nil
+	}
+	if addr, ok := accounts.Find(ref); ok {
+		return addr, nil
+	}
+	return common.Address{}, fmt.Errorf("%q does not match any account alias and is not an address", ref)
+}
+
+// Token symbols are resolved with the registry.
+func NewRules(config *Config, registry *token.Registry) (*Rules, error) {
+	accounts := NewAccounts(config)
+	rules := &Rules{}
+	symbols := newTokenSymbols(config, registry)
+	for i, rc := range config.Rules {
+		r, err := newRule(rc, accounts, symbols)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		if r.name == "" {
+			r.name = fmt.Sprintf("rules[%d]", i)
+		}
+		rules.rules = append(rules.rules, r)
+	}
+	return rules, nil
+}
+
+func newRule(rc RuleConfig, accounts Accounts, symbols *tokenSymbols) (*rule, error) {
+	r := &rule{
+		name:     rc.Name,
+		severity: rc.Severity,
+	}
+	if r.severity == "" {
+		r.severity = SeverityInfo
+	}
+	if _, has := severityLevels[r.severity]; !has {
+		return nil, fmt.Errorf("severity must be %q, %q or %q", SeverityInfo, SeverityWarning, SeverityCritical)
+	}
+
+	switch rc.Action {
+	case "", RuleActionNotify:
+	case RuleActionSuppress:
+		r.suppress = true
+	default:
+		return nil, fmt.Errorf("action must be %q or %q", RuleActionNotify, RuleActionSuppress)
+	}
+
+	switch rc.Direction {
+	case "":
+	case string(EventSent):
+		d := Sent
+		r.direction = &d
+	case string(EventReceived):
+		d := Received
+		r.direction = &d
+	default:
+		return nil, fmt.Errorf("direction must be %q or %q", EventSent, EventReceived)
+	}
+
+	for _, ref := range rc.Accounts {
+		addr, ok := accounts.Find(ref)
+		if !ok {
+			return nil, fmt.Errorf("accounts: %q does not match any account alias or address", ref)
+		}
+		r.accounts = append(r.accounts, addr)
+	}
+	for _, refs := range []struct {
+		refs   []string
+		target *[]common.Address
+		field  string
+	}{
+		{rc.Counterparties, &r.counterparties, "counterparties"},
+		{rc.DenyCounterparties, &r.denyCounterparties, "deny-counterparties"},
+	} {
+		for _, ref := range refs.refs {
+			addr, err := resolveAddressRef(accounts, ref)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", refs.field, err)
+			}
+			*refs.target = append(*refs.target, addr)
+		}
+	}
+	for _, ref := range rc.Tokens {
+		tr, err := symbols.resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("tokens: %w", err)
+		}
+		r.tokens = append(r.tokens, tr)
+	}
+	for _, ref := range rc.DenyTokens {
+		r.denyTokens = append(r.denyTokens, parseTokenRef(ref))
+	}
+	for ref, value := range rc.MinValue {
+		v, err := token.ParseDecimal(value)
+		if err != nil || v.Sign() < 0 {
+			return nil, fmt.Errorf("min-value: %q is not a valid value for %s", value, ref)
+		}
+		r.minValues = append(r.minValues, minValue{ref: parseTokenRef(ref), value: v})
+	}
+	for currency, value := range rc.MinFiat {
+		v, err := token.ParseDecimal(value)
+		if err != nil || v.Sign() < 0 {
+			return nil, fmt.Errorf("min-fiat: %q is not a valid value for %s", value, currency)
+		}
+		if r.minFiat == nil {
+			r.minFiat = make(map[string]*token.Decimal)
+		}
+		r.minFiat[strings.ToUpper(currency)] = v
+	}
+	if rc.QuietHours != "" {
+		q, err := parseQuietHours(rc.QuietHours)
+		if err != nil {
+			return nil, fmt.Errorf("quiet-hours: %w", err)
+		}
+		r.quietHours = q
+	}
+	return r, nil
+}
+
+func matchesToken(refs []tokenRef, t *token.Token) bool {
+	for _, ref := range refs {
+		if ref.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) selects(transfer *Transfer) bool {
+	if len(r.accounts) > 0 && !containsAddress(r.accounts, transfer.Account()) {
+		return false
+	}
+	if r.direction != nil && *r.direction != transfer.Direction {
+		return false
+	}
+	if len(r.tokens) > 0 && !matchesToken(r.tokens, transfer.Token) {
+		return false
+	}
+	if len(r.counterparties) > 0 && !containsAddress(r.counterparties, transfer.Counterparty()) {
+		return false
+	}
+	return true
+}
+
+// Returns the reason why the transfer is filtered out, empty if it passes.
+func (r *rule) filter(transfer *Transfer, now time.Time) string {
+	if matchesToken(r.denyTokens, transfer.Token) {
+		return fmt.Sprintf("token %s is denied", transfer.Token.Symbol)
+	}
+	if containsAddress(r.denyCounterparties, transfer.Counterparty()) {
+		return fmt.Sprintf("counterparty %s is denied", transfer.Counterparty().Hex())
+	}
+	for _, min := range r.minValues {
+		if !min.ref.matches(transfer.Token) {
+			continue
+		}
+		if min.value.CmpAmount(&transfer.Value, int(transfer.Token.Decimals)) < 0 {
+			return fmt.Sprintf("value is below %s %s", min.value, transfer.Token.Symbol)
+		}
+	}
+	for currency, min := range r.minFiat {
+		if value, has := transfer.Fiat[currency]; has && value.Cmp(min.Rat()) < 0 {
+			return fmt.Sprintf("value is below %s %s", min, currency)
+		}
+	}
+	if r.quietHours != nil && r.quietHours.contains(now) && r.severity != SeverityCritical {
+		return "quiet hours"
+	}
+	return ""
+}
+
+// Evaluate returns the decision of the first rule selecting the transfer.
+// Transfers not selected by any rule are notified with info severity.
+func (rs *Rules) Evaluate(transfer *Transfer, now time.Time) *RuleDecision {
+	for _, r := range rs.rules {
+		if !r.selects(transfer) {
+			continue
+		}
+		if r.suppress {
+			return &RuleDecision{Severity: r.severity, Reason: "suppressed by " + r.name}
+		}
+		if reason := r.filter(transfer, now); reason != "" {
+			return &RuleDecision{Severity: r.severity, Reason: reason + " (" + r.name + ")"}
+		}
+		return &RuleDecision{Notify: true, Severity: r.severity}
+	}
+	return &RuleDecision{Notify: true, Severity: SeverityInfo}
+}
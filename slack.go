@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type SlackConfig struct {
+	// Incoming webhook URL, see https://api.slack.com/messaging/webhooks
+	WebhookUrl string          `yaml:"webhook-url"`
+	Templates  TemplatesConfig `yaml:"templates"`
+	Retry      RetryConfig     `yaml:"retry"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string       `json:"type"`
+	Text     *slackText   `json:"text,omitempty"`
+	Fields   []*slackText `json:"fields,omitempty"`
+	Elements []*slackText `json:"elements,omitempty"`
+}
+
+type slackMessage struct {
+	Text   string        `json:"text"`
+	Blocks []*slackBlock `json:"blocks,omitempty"`
+}
+
+type slack struct {
+	config    *SlackConfig
+	explorer  Explorer
+	templates *MessageTemplates
+	client    *http.Client
+	queue     *deliveryQueue
+}
+
+// Returns nil notifier if Slack is not configured.
+func NewSlack(config *Config, store Store) (Notifier, error) {
+	if config.Slack == nil {
+		return nil, nil
+	}
+	templates, err := NewMessageTemplates(config, config.Slack.Templates, slackEscaper.Replace)
+	if err != nil {
+		return nil, err
+	}
+	s := &slack{
+		config:    config.Slack,
+		explorer:  NewExplorer(config),
+		templates: templates,
+		client:    &http.Client{Timeout: DefaultWebhookTimeout},
+	}
+	s.queue = newDeliveryQueue(store, deliveryQueueConfig{
+		Name:     s.Name(),
+		Retry:    config.Slack.Retry,
+		MaxBatch: NotificationMaxBatch,
+		Interval: SlackMinInterval,
+		Send:     s.post,
+	})
+	return s, nil
+}
+
+func (s *slack) Name() string {
+	return "slack"
+}
+
+func (s *slack) Notify(ctx context.Context, event *Event) error {
+	return s.queue.Push(event)
+}
+
+func (s *slack) Close() {
+	s.queue.Close()
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func slackLink(text, url string) string {
+	return fmt.Sprintf("<%s|%s>", url, slackEscaper.Replace(text))
+}
+
+// Renders events into a single message, transfers get rich blocks.
+func (s *slack) render(events []*Event) *slackMessage {
+	msg := &slackMessage{}
+	texts := make([]string, 0, len(events))
+	for _, event := range events {
+		texts = append(texts, s.templates.RenderWithWarnings(event))
+		if len(msg.Blocks) > 0 {
+			msg.Blocks = append(msg.Blocks, &slackBlock{Type: "divider"})
+		}
+		msg.Blocks = append(msg.Blocks, s.renderBlocks(event)...)
+	}
+	msg.Text = strings.Join(texts, "\n")
+	return msg
+}
+
+func (s *slack) renderBlocks(event *Event) []*slackBlock {
+	var blocks []*slackBlock
+	if len(event.Warnings) > 0 {
+		lines := make([]string, 0, len(event.Warnings))
+		for _, warning := range event.Warnings {
+			lines = append(lines, fmt.Sprintf(":warning: *%s*", slackEscaper.Replace(warning)))
+		}
+		blocks = append(blocks, &slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: strings.Join(lines, "\n")},
+		})
+	}
+	blocks = append(blocks, &slackBlock{
+		Type: "section",
+		Text: &slackText{Type: "mrkdwn", Text: s.templates.Render(event)},
+	})
+	if event.Transfer == nil {
+		return blocks
+	}
+
+	fields := make([]*slackText, 0, 4)
+	for _, f := range transferFields(event, s.explorer, slackLink, slackEscaper.Replace) {
+		fields = append(fields, &slackText{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*%s*\n%s", f.Name, f.Value),
+		})
+	}
+
+	return append(blocks,
+		&slackBlock{
+			Type:   "section",
+			Fields: fields,
+		},
+		&slackBlock{
+			Type: "context",
+			Elements: []*slackText{{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("%s · block %d", slackLink("View transaction", s.explorer.TxUrl(event.Transfer.TxHash)), event.Transfer.BlockNumber),
+			}},
+		},
+	)
+}
+
+func (s *slack) post(ctx context.Context, events []*Event) error {
+	body, err := json.Marshal(s.render(events))
+	if err != nil {
+		return Permanent(err)
+	}
+	return postJSON(ctx, s.client, s.config.WebhookUrl, nil, body)
+}
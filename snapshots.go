@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	snapshotsBucket  = "snapshots"
+	lowBalanceBucket = "low-balance"
+)
+
+type LowBalanceConfig struct {
+	// Account alias or address.
+	Account string `yaml:"account"`
+	// ETH or token contract address.
+	Token string `yaml:"token"`
+	// Alert when the balance drops below this value, in token units.
+	Below    string `yaml:"below"`
+	Severity string `yaml:"severity"`
+}
+
+type SnapshotsConfig struct {
+	// Snapshot balances every N blocks.
+	Interval uint64 `yaml:"interval"`
+	// Alert on balance changes not explained by observed transfers.
+	UnexplainedChanges bool `yaml:"unexplained-changes"`
+	// ETH decreases up to this value are attributed to gas fees, in ETH.
+	GasTolerance string             `yaml:"gas-tolerance"`
+	LowBalance   []LowBalanceConfig `yaml:"low-balance"`
+}
+
+// Snapshot is an account token balance at a block.
+type Snapshot struct {
+	Block uint64
+	Time  time.Time
+	Value *big.Int
+}
+
+// BalanceAlert describes a balance snapshot alert.
+type BalanceAlert struct {
+	Account common.Address
+	Token   *token.Token
+	Block   uint64
+	Balance *big.Int
+	// Low balance threshold.
+	Threshold *token.Decimal
+	// Unexplained change of the balance since FromBlock.
+	FromBlock  uint64
+	Difference *big.Int
+}
+
+// Snapshots persists balance time series per account and token.
+type Snapshots interface {
+	Add(account, tokenAddr common.Address, snapshot *Snapshot) error
+	// Returns up to limit latest snapshots, newest first.
+	Latest(account, tokenAddr common.Address, limit int) ([]*Snapshot, error)
+}
+
+type snapshots struct {
+	store Store
+}
+
+func NewSnapshots(store Store) Snapshots {
+	return &snapshots{
+		store: store,
+	}
+}
+
+func snapshotsBucketOf(account, tokenAddr common.Address) string {
+	return snapshotsBucket + "/" + account.Hex() + "/" + tokenAddr.Hex()
+}
+
+func (s *snapshots) Add(account, tokenAddr common.Address, snapshot *Snapshot) error {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, snapshot.Block)
+	return s.store.Put(snapshotsBucketOf(account, tokenAddr), key, snapshot)
+}
+
+func (s *snapshots) Latest(account, tokenAddr common.Address, limit int) ([]*Snapshot, error) {
+	var result []*Snapshot
+	err := s.store.ForEachReverse(snapshotsBucketOf(account, tokenAddr), func(key []byte, decode func(value interface{}) error) (bool, error) {
+		snapshot := &Snapshot{}
+		if err := decode(snapshot); err != nil {
+			return false, err
+		}
+		result = append(result, snapshot)
+		return len(result) < limit, nil
+	})
+	return result, err
+}
+
+type lowBalance struct {
+	account   common.Address
+	tokenAddr common.Address
+	below     *token.Decimal
+	severity  string
+}
+
+func newLowBalance(lc LowBalanceConfig, accounts Accounts) (*lowBalance, error) {
+	lb := &lowBalance{
+		severity: lc.Severity,
+	}
+	var ok bool
+	if lb.account, ok = accounts.Find(lc.Account); !ok {
+		return nil, fmt.Errorf("account: %q does not match any account alias or address", lc.Account)
+	}
+	var err error
+	if lb.tokenAddr, err = parseTokenAddress(lc.Token); err != nil {
+		return nil, fmt.Errorf("token: %w", err)
+	}
+	if lb.below, err = token.ParseDecimal(lc.Below); err != nil || lb.below.Sign() <= 0 {
+		return nil, fmt.Errorf("below: %q is not a positive value", lc.Below)
+	}
+	if lb.severity == "" {
+		lb.severity = SeverityWarning
+	}
+	if _, has := severityLevels[lb.severity]; !has {
+		return nil, fmt.Errorf("severity must be %q, %q or %q", SeverityInfo, SeverityWarning, SeverityCritical)
+	}
+	return lb, nil
+}
+
+// Tracks the run of contiguously processed blocks, the transfers history is complete only within it.
+// A block which failed to process, a missed head or a restart starts a new run.
+type processedBlocks struct {
+	mu          sync.Mutex
+	start, last uint64
+}
+
+func (p *processedBlocks) add(number uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.last != 0 && number == p.last+1:
+		p.last = number
+	case p.last == 0 || number > p.last:
+		p.start, p.last = number, number
+	}
+	// Earlier numbers are reorged blocks processed again, the run goes on.
+}
+
+// Reports whether a change between two snapshots can be explained by the history:
+// the snapshots are consecutive and all blocks between them were processed in the current run.
+func (p *processedBlocks) explainable(from, to *Snapshot, interval uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return to.Block-from.Block == interval && p.last != 0 && from.Block >= p.start && to.Block <= p.last
+}
+
+// BalanceMonitor snapshots balances of all accounts every configured number of blocks
+// and alerts on low balances and balance changes not explained by observed transfers.
+type BalanceMonitor struct {
+	app       *App
+	snapshots Snapshots
+	blocks    chan uint64
+	processed processedBlocks
+}
+
+func NewBalanceMonitor(app *App, snapshots Snapshots) *BalanceMonitor {
+	return &BalanceMonitor{
+		app:       app,
+		snapshots: snapshots,
+		blocks:    make(chan uint64, 1),
+	}
+}
+
+// BlockProcessed records a completely processed block and schedules a snapshot if it is due. Never blocks,
+// a block is skipped if the previous snapshot is still in progress.
+func (m *BalanceMonitor) BlockProcessed(number uint64) {
+	m.processed.add(number)
+	config := m.app.Config().Snapshots
+	if config == nil || number%config.Interval != 0 {
+		return
+	}
+	select {
+	case m.blocks <- number:
+	default:
+		log.Printf("Skipping balance snapshot at block %d, previous one is still in progress", number)
+	}
+}
+
+func (m *BalanceMonitor) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case number := <-m.blocks:
+			if config := m.app.Config().Snapshots; config != nil {
+				m.snapshot(ctx, config, number)
+			}
+		}
+	}
+}
+
+type snapshotKey struct {
+	account   common.Address
+	tokenAddr common.Address
+}
+
+// Transfers observed between the previous two snapshots are in history by now,
+// so unexplained changes are checked one interval behind the latest snapshot.
+type driftCheck struct {
+	token      *token.Token
+	from, to   *Snapshot
+	difference *big.Int
+}
+
+func (m *BalanceMonitor) snapshot(ctx context.Context, config *SnapshotsConfig, number uint64) {
+	accounts := m.app.Accounts()
+	tracked := m.app.TrackedTokens(ctx)
+
+	lowBalances := make(map[snapshotKey]*lowBalance)
+	for _, lc := range config.LowBalance {
+		lb, err := newLowBalance(lc, accounts)
+		if err != nil {
+			continue // validated with the config
+		}
+		key := snapshotKey{account: lb.account, tokenAddr: lb.tokenAddr}
+		lowBalances[key] = lb
+		if !containsToken(tracked[lb.account], lb.tokenAddr) {
+			t, err := m.app.tokensManager.GetToken(ctx, lb.tokenAddr)
+			if err != nil {
+				log.Printf("Skipping low balance alert of %s, token %s is not available: %v", accounts.Lookup(lb.account), lb.tokenAddr.Hex(), err)
+				continue
+			}
+			tracked[lb.account] = append(tracked[lb.account], t)
+		}
+	}
+
+	block := new(big.Int).SetUint64(number)
+	now := time.Now()
+	var requests []token.BalanceRequest
+	for _, account := range accounts.Sorted() {
+		for _, t := range tracked[account] {
+			requests = append(requests, token.BalanceRequest{Token: t, Addr: account})
+		}
+	}
+	results := m.app.tokensManager.FetchBalances(ctx, requests, block)
+
+	checks := make(map[snapshotKey]*driftCheck)
+	var minBlock uint64 = number
+	for i, r := range requests {
+		account, t := r.Addr, r.Token
+		key := snapshotKey{account: account, tokenAddr: t.Address}
+		value, err := results[i].Value, results[i].Err
+		if err != nil {
+			log.Printf("Failed to snapshot %s balance of %s: %v", t.Symbol, accounts.Lookup(account), err)
+			continue
+		}
+		previous, err := m.snapshots.Latest(account, t.Address, 2)
+		if err != nil {
+			log.Printf("Failed to read balance snapshots: %v", err)
+		}
+		if err := m.snapshots.Add(account, t.Address, &Snapshot{Block: number, Time: now, Value: value}); err != nil {
+			log.Printf("Failed to save balance snapshot: %v", err)
+		}
+
+		if lb, has := lowBalances[key]; has {
+			m.checkLowBalance(ctx, lb, t, number, value)
+		}
+		if config.UnexplainedChanges && len(previous) == 2 && m.processed.explainable(previous[1], previous[0], config.Interval) {
+			from, to := previous[1], previous[0]
+			checks[key] = &driftCheck{
+				token:      t,
+				from:       from,
+				to:         to,
+				difference: new(big.Int).Sub(to.Value, from.Value),
+			}
+			if from.Block < minBlock {
+				minBlock = from.Block
+			}
+		}
+	}
+	if len(checks) > 0 {
+		m.checkDrifts(ctx, config, checks, minBlock)
+	}
+}
+
+func containsToken(tokens []*token.Token, addr common.Address) bool {
+	for _, t := range tokens {
+		if t.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Alerts once when the balance drops below the threshold, again only after it recovers.
+func (m *BalanceMonitor) checkLowBalance(ctx context.Context, lb *lowBalance, t *token.Token, number uint64, value *big.Int) {
+	key := append(lb.account.Bytes(), lb.tokenAddr.Bytes()...)
+	var alerted bool
+	if err := m.app.store.Get(lowBalanceBucket, key, &alerted); err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		log.Printf("Failed to read low balance state: %v", err)
+	}
+
+	low := lb.below.CmpAmount(value, int(t.Decimals)) < 0
+	if low == alerted {
+		return
+	}
+	if err := m.app.store.Put(lowBalanceBucket, key, low); err != nil {
+		log.Printf("Failed to save low balance state: %v", err)
+	}
+	if !low {
+		log.Printf("%s balance of %s recovered above %s", t.Symbol, m.app.Accounts().Lookup(lb.account), lb.below)
+		return
+	}
+
+	m.notify(ctx, EventLowBalance, lb.severity, &BalanceAlert{
+		Account:   lb.account,
+		Token:     t,
+		Block:     number,
+		Balance:   value,
+		Threshold: lb.below,
+	})
+}
+
+func (m *BalanceMonitor) checkDrifts(ctx context.Context, config *SnapshotsConfig, checks map[snapshotKey]*driftCheck, minBlock uint64) {
+	// Subtract observed transfers from the balance differences, what remains is unexplained.
+	err := m.app.history.ForEachReverse(func(entry *HistoryEntry) (bool, error) {
+		tr := entry.Transfer
+		if tr.BlockNumber <= minBlock {
+			return false, nil
+		}
+		check, has := checks[snapshotKey{account: tr.Account(), tokenAddr: tr.Token.Address}]
+		if !has || tr.BlockNumber <= check.from.Block || tr.BlockNumber > check.to.Block {
+			return true, nil
+		}
+		if tr.Direction == Received {
+			check.difference.Sub(check.difference, &tr.Value)
+		} else {
+			check.difference.Add(check.difference, &tr.Value)
+		}
+		return true, nil
+	})
+	if err != nil {
+		log.Printf("Failed to read transfers history: %v", err)
+		return
+	}
+
+	gasTolerance := new(big.Int)
+	if config.GasTolerance != "" {
+		if tolerance, err := token.ParseAmount(config.GasTolerance, int(token.ETHToken.Decimals)); err == nil {
+			gasTolerance = tolerance
+		}
+	} else {
+		gasTolerance, _ = token.ParseAmount(DefaultSnapshotGasTolerance, int(token.ETHToken.Decimals))
+	}
+
+	for key, check := range checks {
+		if check.difference.Sign() == 0 {
+			continue
+		}
+		if key.tokenAddr == token.ETHToken.Address && check.difference.Sign() < 0 &&
+			new(big.Int).Neg(check.difference).Cmp(gasTolerance) <= 0 {
+			continue
+		}
+		m.notify(ctx, EventBalanceChange, SeverityWarning, &BalanceAlert{
+			Account:    key.account,
+			Token:      check.token,
+			Block:      check.to.Block,
+			Balance:    check.to.Value,
+			FromBlock:  check.from.Block,
+			Difference: check.difference,
+		})
+	}
+}
+
+func (m *BalanceMonitor) notify(ctx context.Context, kind EventKind, severity string, alert *BalanceAlert) {
+	format := m.app.AmountFormat()
+	event := &Event{
+		Kind:     kind,
+		Time:     time.Now(),
+		Severity: severity,
+		Alert:    alert,
+		Account:  m.app.Accounts().Lookup(alert.Account),
+		Balance:  alert.Token.FormatValue(alert.Balance, format),
+	}
+	if alert.Difference != nil {
+		event.Value = alert.Token.FormatValue(alert.Difference, format)
+	}
+	templates := m.app.Templates()
+	event.Message = templates.Render(event)
+
+	log.Println(event.Message)
+	m.app.Notifier().Notify(ctx, event)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestProcessedBlocksExplainable(t *testing.T) {
+	snapshot := func(block uint64) *Snapshot { return &Snapshot{Block: block} }
+	tests := []struct {
+		name      string
+		processed [][2]uint64
+		from, to  uint64
+		want      bool
+	}{
+		{name: "contiguous", processed: [][2]uint64{{90, 300}}, from: 100, to: 200, want: true},
+		{name: "not an interval apart", processed: [][2]uint64{{90, 300}}, from: 100, to: 300},
+		{name: "downtime gap", processed: [][2]uint64{{90, 150}, {180, 300}}, from: 100, to: 200},
+		{name: "after downtime", processed: [][2]uint64{{90, 150}, {180, 300}}, from: 200, to: 300, want: true},
+		{name: "run started at the snapshot", processed: [][2]uint64{{100, 200}}, from: 100, to: 200, want: true},
+		{name: "snapshot before startup", processed: [][2]uint64{{101, 200}}, from: 100, to: 200},
+		{name: "nothing processed", from: 100, to: 200},
+	}
+	for _, tt := range tests {
+		var p processedBlocks
+		for _, run := range tt.processed {
+			for number := run[0]; number <= run[1]; number++ {
+				p.add(number)
+			}
+		}
+		if got := p.explainable(snapshot(tt.from), snapshot(tt.to), 100); got != tt.want {
+			t.Errorf("%s: explainable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessedBlocksReorg(t *testing.T) {
+	var p processedBlocks
+	for number := uint64(100); number <= 205; number++ {
+		p.add(number)
+	}
+	// A reorg processes the replaced blocks again.
+	for number := uint64(203); number <= 210; number++ {
+		p.add(number)
+	}
+	if !p.explainable(&Snapshot{Block: 100}, &Snapshot{Block: 200}, 100) {
+		t.Error("run was reset by a reorg")
+	}
+}
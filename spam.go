@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	SpamActionMark     = "mark"
+	SpamActionSuppress = "suppress"
+	SpamActionOff      = "off"
+)
+
+type SpamConfig struct {
+	// What to do with suspicious transfers: "mark" (default), "suppress" or "off".
+	Action string `yaml:"action"`
+	// Trusted token contract addresses, never flagged as spam.
+	AllowTokens []string `yaml:"allow-tokens"`
+	// Number of leading and trailing hex characters compared to detect lookalike addresses.
+	LookalikeChars int `yaml:"lookalike-chars"`
+	// Well-known tokens per symbol in addition to the built-in ones of the chain, e.g. `USDT: 0x...`.
+	KnownTokens map[string]string `yaml:"known-tokens"`
+}
+
+// Well-known tokens per chain which are commonly impersonated.
+var knownTokensByChain = map[uint64]map[string]common.Address{
+	1: mainnetKnownTokens,
+}
+
+var mainnetKnownTokens = map[string]common.Address{
+	"USDT":  common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"),
+	"USDC":  common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"),
+	"DAI":   common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"),
+	"WETH":  common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"),
+	"WBTC":  common.HexToAddress("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"),
+	"LINK":  common.HexToAddress("0x514910771AF9Ca656af840dff83E8264EcF986CA"),
+	"UNI":   common.HexToAddress("0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984"),
+	"MATIC": common.HexToAddress("0x7D1AfA7B718fb893dB30A3aBc0Cfc608AaCfeBB0"),
+	"SHIB":  common.HexToAddress("0x95aD61b0a150d79219dCF64E1E6Cc01f0B64C4cE"),
+	"APE":   common.HexToAddress("0x4d224452801ACEd8B2F0aebE155379bb5D594381"),
+}
+
+// Latin lookalikes of characters often used in fake token symbols.
+var symbolHomoglyphs = strings.NewReplacer(
+	"А", "A", "В", "B", "С", "C", "Е", "E", "Н", "H", "І", "I", "К", "K", "М", "M", "О", "O", "Р", "P", "Т", "T", "Х", "X", "У", "Y",
+	"а", "A", "с", "C", "е", "E", "о", "O", "р", "P", "х", "X", "у", "Y",
+	"Ο", "O", "Τ", "T", "Α", "A", "Β", "B", "Ε", "E", "Κ", "K", "Μ", "M", "Ν", "N", "Ρ", "P", "Χ", "X",
+	"0", "O", "$", "S",
+)
+
+// Normalizes a token symbol for impersonation checks: homoglyphs are folded and
+// everything except letters and digits is dropped, so "USDТ", "U.S.D.T" and "usdt" are all "USDT".
+// Digits are kept, so distinct tokens like "USDC2" or "1INCH" are not taken for "USDC" or "INCH".
+func normalizeSymbol(symbol string) string {
+	symbol = symbolHomoglyphs.Replace(symbol)
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, symbol)
+}
+
+// SpamFilter flags suspicious transfers: zero-value transfers, lookalike counterparty
+// addresses and tokens impersonating well-known ones.
+type SpamFilter struct {
+	action         string
+	lookalikeChars int
+	allowTokens    map[common.Address]bool
+	knownTokens    map[string]common.Address
+	counterparties Counterparties
+}
+
+// Returns well-known tokens of the configured chain per symbol, including the configured ones.
+func knownTokens(config *Config) map[string]common.Address {
+	tokens := make(map[string]common.Address)
+	for symbol, addr := range knownTokensByChain[configChainId(config)] {
+		tokens[symbol] = addr
+	}
+	if config.Spam != nil {
+		for symbol, addr := range config.Spam.KnownTokens {
+			tokens[symbol] = common.HexToAddress(addr)
+		}
+	}
+	return tokens
+}
+
+func NewSpamFilter(config *Config, counterparties Counterparties) *SpamFilter {
+	f := &SpamFilter{
+		action:         SpamActionMark,
+		lookalikeChars: DefaultLookalikeChars,
+		allowTokens:    make(map[common.Address]bool),
+		knownTokens:    make(map[string]common.Address),
+		counterparties: counterparties,
+	}
+	for symbol, addr := range knownTokens(config) {
+		f.knownTokens[normalizeSymbol(symbol)] = addr
+	}
+	if config.Spam != nil {
+		if config.Spam.Action != "" {
+			f.action = config.Spam.Action
+		}
+		if config.Spam.LookalikeChars > 0 {
+			f.lookalikeChars = config.Spam.LookalikeChars
+		}
+		for _, addr := range config.Spam.AllowTokens {
+			f.allowTokens[common.HexToAddress(addr)] = true
+		}
+	}
+	return f
+}
+
+// Suppress reports whether suspicious transfers should not be notified.
+func (f *SpamFilter) Suppress() bool {
+	return f.action == SpamActionSuppress
+}
+
+// Check sets transfer.Suspicious to the reasons why the transfer looks suspicious
+// and transfer.LookalikeOf if the counterparty imitates a known one.
+func (f *SpamFilter) Check(transfer *Transfer) {
+	if f.action == SpamActionOff {
+		return
+	}
+
+	// Zero-value ETH transactions sent by the account are plain contract calls,
+	// while zero-value token transfers can be emitted by anyone via transferFrom.
+	if transfer.Value.Sign() == 0 && (transfer.Direction == Received || transfer.Token.Address != token.ETHToken.Address) {
+		transfer.Suspicious = append(transfer.Suspicious, "zero-value transfer")
+	}
+	if reason := f.checkToken(transfer.Token); reason != "" {
+		transfer.Suspicious = append(transfer.Suspicious, reason)
+	}
+	f.checkCounterparty(transfer)
+}
+
+// SuspiciousToken reports whether the token impersonates ether or a well-known token.
+func (f *SpamFilter) SuspiciousToken(t *token.Token) bool {
+	return f.action != SpamActionOff && f.checkToken(t) != ""
+}
+
+func (f *SpamFilter) checkToken(t *token.Token) string {
+	if t.Address == token.ETHToken.Address || f.allowTokens[t.Address] {
+		return ""
+	}
+	symbol := normalizeSymbol(t.Symbol)
+	if symbol == normalizeSymbol(token.ETHToken.Symbol) {
+		return fmt.Sprintf("token %s pretends to be ether", t.Address.Hex())
+	}
+	if addr, known := f.knownTokens[symbol]; known && addr != t.Address {
+		return fmt.Sprintf("token %s impersonates %s at %s", t.Address.Hex(), symbol, addr.Hex())
+	}
+	return ""
+}
+
+// Flags counterparties which are not known to the account but look like known ones.
+func (f *SpamFilter) checkCounterparty(transfer *Transfer) {
+	account, counterparty := transfer.Account(), transfer.Counterparty()
+	known, err := f.counterparties.Get(account, counterparty)
+	if err == nil && known == nil {
+		known, err = f.counterparties.Lookalike(account, counterparty, f.lookalikeChars)
+		if err == nil && known != nil {
+			transfer.LookalikeOf = &known.Address
+			reason := "possible address poisoning: %s imitates known counterparty %s"
+			if transfer.Direction == Sent {
+				reason = "sent to %s which imitates known counterparty %s, check the recipient address"
+			}
+			transfer.Suspicious = append(transfer.Suspicious, fmt.Sprintf(reason, counterparty.Hex(), known.Address.Hex()))
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to read counterparties: %v", err)
+	}
+}
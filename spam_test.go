@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestNormalizeSymbol(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"USDT", "USDT"},
+		{"usdt", "USDT"},
+		{"U.S.D.T", "USDT"},
+		{"USD₮", "USD"},
+		{"USDТ", "USDT"}, // Cyrillic Т
+		{"ЕТН", "ETH"},   // Cyrillic
+		{"U$DC", "USDC"},
+		{"DA0", "DAO"},
+		{"ETH2", "ETH2"},
+		{"USDC2", "USDC2"},
+		{"1INCH", "1INCH"},
+		{"WETH-9", "WETH9"},
+	}
+	for _, tt := range tests {
+		if got := normalizeSymbol(tt.symbol); got != tt.want {
+			t.Errorf("normalizeSymbol(%q) = %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
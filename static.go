@@ -2,16 +2,67 @@ package main
 
 import (
 	"strings"
+	"time"
 
 	"github.com/andrei-toptal/eth-listener/token/erc20"
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
 const (
-	ConfigPath        = "config.yaml"
+	DefaultConfigPath = "config.yaml"
+	EnvPrefix         = "ETH_LISTENER_"
 	TokensDBPath      = ".tokens-db"
+	StoreDBPath       = ".eth-listener-db"
 	TransfersChBuffer = 32
+
+	ConfigPollInterval = 5 * time.Second
+
+	DefaultRetryMaxAttempts    = 10
+	DefaultRetryInitialBackoff = time.Second
+	DefaultRetryMaxBackoff     = 10 * time.Minute
+	// Rate limited attempts don't count as failures, but a notification can't wait forever.
+	RetryMaxRateLimited = 100
+
+	// Limits below follow the documented rate limits of each service.
+	NotificationMaxBatch     = 10
+	TelegramChatMinInterval  = time.Second
+	TelegramGroupMinInterval = 3 * time.Second
+	TelegramMaxMessageLength = 4096
+	SlackMinInterval         = time.Second
+	DiscordMinInterval       = time.Second
+
+	DefaultExplorerUrl = "https://etherscan.io"
+	DefaultChainId     = 1
+
+	DefaultWebhookTimeout         = 10 * time.Second
+	DefaultWebhookSignatureHeader = "X-Signature-256"
+
+	DefaultEmailPort = 587
+
+	TelegramCommandTimeout  = 30 * time.Second
+	TelegramHistoryLimit    = 10
+	TelegramHistoryMaxLimit = 50
+
+	TelegramMaxConcurrentCommands = 4
+	// Longer command replies are truncated.
+	TelegramMaxReplyMessages = 5
+
+	TelegramMaxPairingAttempts = 5
+
+	DefaultLookalikeChars = 4
+	// Hex characters of an address.
+	MaxLookalikeChars = 2 * common.AddressLength
+	WarningSign       = "⚠️"
+
+	DefaultFiatCurrency = "USD"
+
+	DefaultSnapshotGasTolerance = "0.05"
+
+	HTTPReadTimeout     = 10 * time.Second
+	HTTPShutdownTimeout = 5 * time.Second
+	PortfolioTimeout    = time.Minute
 )
 
 var (
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// SyncStatus tracks the progress of block processing and RPC health.
+type SyncStatus struct {
+	mu            sync.RWMutex
+	startedAt     time.Time
+	lastBlock     uint64
+	lastBlockTime time.Time
+	lastError     error
+	lastErrorAt   time.Time
+}
+
+func NewSyncStatus() *SyncStatus {
+	return &SyncStatus{
+		startedAt: time.Now(),
+	}
+}
+
+func (s *SyncStatus) BlockProcessed(header *types.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastBlock = header.Number.Uint64()
+	s.lastBlockTime = time.Unix(int64(header.Time), 0)
+}
+
+func (s *SyncStatus) RpcFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err
+	s.lastErrorAt = time.Now()
+}
+
+type StatusReport struct {
+	StartedAt     time.Time
+	LastBlock     uint64
+	LastBlockTime time.Time
+	LastError     error
+	LastErrorAt   time.Time
+	// Chain head as reported by the node right now, zero if the node is unreachable.
+	HeadBlock  uint64
+	RpcLatency time.Duration
+	RpcError   error
+}
+
+// Lag returns how many blocks the last processed block is behind the chain head.
+func (r *StatusReport) Lag() uint64 {
+	if r.HeadBlock < r.LastBlock {
+		return 0
+	}
+	return r.HeadBlock - r.LastBlock
+}
+
+// Status returns the current sync status, probing the node for the chain head.
+func (app *App) Status(ctx context.Context) *StatusReport {
+	app.status.mu.RLock()
+	report := &StatusReport{
+		StartedAt:     app.status.startedAt,
+		LastBlock:     app.status.lastBlock,
+		LastBlockTime: app.status.lastBlockTime,
+		LastError:     app.status.lastError,
+		LastErrorAt:   app.status.lastErrorAt,
+	}
+	app.status.mu.RUnlock()
+
+	start := time.Now()
+	head, err := app.client.BlockNumber(ctx)
+	report.RpcLatency = time.Since(start)
+	if err != nil {
+		report.RpcError = err
+	} else {
+		report.HeadBlock = head
+	}
+	return report
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"os"
+	"path"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Store persists the app state (delivery queues etc.) grouped into buckets.
+// Values are gob-encoded.
+type Store interface {
+	Put(bucket string, key []byte, value interface{}) error
+	// Returns leveldb.ErrNotFound for missing keys.
+	Get(bucket string, key []byte, value interface{}) error
+	Delete(bucket string, key []byte) error
+	// Iterates bucket keys in ascending order until fn returns false or an error.
+	ForEach(bucket string, fn func(key []byte, decode func(value interface{}) error) (bool, error)) error
+	// Same as ForEach but in descending key order.
+	ForEachReverse(bucket string, fn func(key []byte, decode func(value interface{}) error) (bool, error)) error
+	Close()
+}
+
+type store struct {
+	db *leveldb.DB
+}
+
+func NewStore(dbPath string) Store {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Panic(err)
+	}
+	db, err := leveldb.OpenFile(path.Join(homeDir, dbPath), nil)
+	if err != nil {
+		log.Panicf("Failed to open Store: %v", err)
+	}
+	return &store{
+		db: db,
+	}
+}
+
+func (s *store) Close() {
+	if err := s.db.Close(); err != nil {
+		log.Printf("Failed to close DB: %v", err)
+	}
+}
+
+func bucketKey(bucket string, key []byte) []byte {
+	return append([]byte(bucket+"/"), key...)
+}
+
+func (s *store) Put(bucket string, key []byte, value interface{}) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(value); err != nil {
+		return err
+	}
+	return s.db.Put(bucketKey(bucket, key), buf.Bytes(), nil)
+}
+
+func (s *store) Get(bucket string, key []byte, value interface{}) error {
+	data, err := s.db.Get(bucketKey(bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
+
+func (s *store) Delete(bucket string, key []byte) error {
+	return s.db.Delete(bucketKey(bucket, key), nil)
+}
+
+func (s *store) ForEach(bucket string, fn func(key []byte, decode func(value interface{}) error) (bool, error)) error {
+	return s.iterate(bucket, false, fn)
+}
+
+func (s *store) ForEachReverse(bucket string, fn func(key []byte, decode func(value interface{}) error) (bool, error)) error {
+	return s.iterate(bucket, true, fn)
+}
+
+func (s *store) iterate(bucket string, reverse bool, fn func(key []byte, decode func(value interface{}) error) (bool, error)) error {
+	prefix := []byte(bucket + "/")
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	next, ok := iter.Next, iter.First()
+	if reverse {
+		next, ok = iter.Prev, iter.Last()
+	}
+	for ; ok; ok = next() {
+		key := append([]byte{}, iter.Key()[len(prefix):]...)
+		data := iter.Value()
+		decode := func(value interface{}) error {
+			return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+		}
+		more, err := fn(key, decode)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	return iter.Error()
+}
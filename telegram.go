@@ -1,59 +1,265 @@
 package main
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf16"
 
-	"go.uber.org/atomic"
-
+	"github.com/ethereum/go-ethereum/common"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-type Telegram interface {
-	Notify(message string)
-	Close()
+const telegramSubscriptionsBucket = "telegram/subscriptions"
+
+type telegramSubscription struct {
+	ChatID int64
+	// Telegram user who last changed the subscription, notifications stop once the user is revoked.
+	UserID int64
+	// Addresses of followed accounts, empty means all accounts.
+	Accounts []common.Address
+}
+
+// Returns the subscribing user, subscriptions saved without one belong to the private chat's user.
+func (s *telegramSubscription) owner() int64 {
+	if s.UserID == 0 && s.ChatID > 0 {
+		return s.ChatID
+	}
+	return s.UserID
 }
 
-type noopTelegram struct{}
+func (s *telegramSubscription) follows(addr common.Address) bool {
+	return len(s.Accounts) == 0 || containsAddress(s.Accounts, addr)
+}
 
-func (noopTelegram) Notify(string) {}
-func (noopTelegram) Close()        {}
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
 
 type telegram struct {
-	bot        *tgbotapi.BotAPI
-	stopCh     chan struct{}
-	waitStop   sync.WaitGroup
-	username   string
-	subscribed atomic.Bool
-	chatID     int64
+	bot     *tgbotapi.BotAPI
+	store   Store
+	backend BotBackend
+	auth    *telegramAuth
+	// Cancelled on Close, stops the updates loop and running commands.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	waitStop sync.WaitGroup
+	// Limits the number of commands handled at once.
+	commandSlots chan struct{}
+
+	retry RetryConfig
+	// Parse mode and templates of outgoing notifications.
+	parseMode string
+	templates *MessageTemplates
+
+	mu            sync.Mutex
+	subscriptions map[int64]*telegramSubscription
+	// Outbound queue per subscribed chat.
+	queues map[int64]*deliveryQueue
 }
 
-func NewTelegram(config *Config) Telegram {
+// Returns nil notifier if Telegram is not configured.
+func NewTelegram(config *Config, store Store, backend BotBackend) (Notifier, error) {
 	if config.Telegram == nil {
-		log.Println("Using no-op Telegram due to missing config")
-		return noopTelegram{}
+		return nil, nil
 	}
 
 	bot, err := tgbotapi.NewBotAPI(config.Telegram.Token)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	templates, err := NewMessageTemplates(config, config.Telegram.Templates, telegramEscape(config.Telegram.ParseMode))
+	if err != nil {
+		return nil, err
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	t := &telegram{
-		bot:      bot,
-		stopCh:   make(chan struct{}),
-		username: config.Telegram.Username,
+		bot:           bot,
+		store:         store,
+		backend:       backend,
+		ctx:           ctx,
+		cancel:        cancel,
+		commandSlots:  make(chan struct{}, TelegramMaxConcurrentCommands),
+		retry:         config.Telegram.Retry,
+		parseMode:     config.Telegram.ParseMode,
+		templates:     templates,
+		subscriptions: make(map[int64]*telegramSubscription),
+		queues:        make(map[int64]*deliveryQueue),
+	}
+	if t.auth, err = newTelegramAuth(config.Telegram, store); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := t.loadSubscriptions(); err != nil {
+		cancel()
+		return nil, err
 	}
+
 	t.waitStop.Add(1)
 	go t.updatesLoop()
-	return t
+	return t, nil
 }
 
-func (t *telegram) Notify(message string) {
-	if !t.subscribed.Load() {
-		return
+// Returns the escape func for the given parse mode.
+func telegramEscape(parseMode string) func(string) string {
+	switch parseMode {
+	case tgbotapi.ModeHTML:
+		return escapeHTML
+	case tgbotapi.ModeMarkdownV2:
+		return escapeMarkdown
+	}
+	return noEscape
+}
+
+func (t *telegram) Name() string {
+	return "telegram"
+}
+
+func int64Key(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (t *telegram) loadSubscriptions() error {
+	return t.store.ForEach(telegramSubscriptionsBucket, func(key []byte, decode func(value interface{}) error) (bool, error) {
+		sub := &telegramSubscription{}
+		if err := decode(sub); err != nil {
+			return false, err
+		}
+		t.subscriptions[sub.ChatID] = sub
+		t.queues[sub.ChatID] = t.newChatQueue(sub.ChatID)
+		return true, nil
+	})
+}
+
+func (t *telegram) saveSubscription(sub *telegramSubscription) error {
+	if err := t.store.Put(telegramSubscriptionsBucket, int64Key(sub.ChatID), sub); err != nil {
+		return err
 	}
-	msg := tgbotapi.NewMessage(t.chatID, message)
-	t.bot.Send(msg)
+	t.subscriptions[sub.ChatID] = sub
+	if _, has := t.queues[sub.ChatID]; !has {
+		t.queues[sub.ChatID] = t.newChatQueue(sub.ChatID)
+	}
+	return nil
+}
+
+func (t *telegram) deleteSubscription(chatID int64) error {
+	if err := t.store.Delete(telegramSubscriptionsBucket, int64Key(chatID)); err != nil {
+		return err
+	}
+	delete(t.subscriptions, chatID)
+	if queue, has := t.queues[chatID]; has {
+		delete(t.queues, chatID)
+		if err := queue.Purge(); err != nil {
+			log.Printf("Failed to drop pending Telegram notifications for chat %d: %v", chatID, err)
+		}
+	}
+	return nil
+}
+
+func (t *telegram) newChatQueue(chatID int64) *deliveryQueue {
+	interval := TelegramChatMinInterval
+	if chatID < 0 {
+		interval = TelegramGroupMinInterval
+	}
+	return newDeliveryQueue(t.store, deliveryQueueConfig{
+		Name:     fmt.Sprintf("telegram/%d", chatID),
+		Retry:    t.retry,
+		MaxBatch: NotificationMaxBatch,
+		MaxSize:  TelegramMaxMessageLength,
+		Size: func(event *Event) int {
+			return telegramLength(t.templates.RenderWithWarnings(event)) + len(telegramEventSeparator)
+		},
+		Interval: interval,
+		Send: func(ctx context.Context, events []*Event) error {
+			return t.send(chatID, events)
+		},
+	})
+}
+
+const telegramEventSeparator = "\n\n"
+
+// Returns the length of the text as counted by Telegram, in UTF-16 code units.
+// Markup is counted too, so the result is an upper bound for formatted messages.
+func telegramLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// Sends events to the chat as a single message.
+func (t *telegram) send(chatID int64, events []*Event) error {
+	texts := make([]string, 0, len(events))
+	for _, event := range events {
+		texts = append(texts, t.templates.RenderWithWarnings(event))
+	}
+	msg := tgbotapi.NewMessage(chatID, strings.Join(texts, telegramEventSeparator))
+	msg.ParseMode = t.parseMode
+	_, err := t.bot.Send(msg)
+
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		if tgErr.RetryAfter > 0 {
+			return RetryAfter(err, time.Duration(tgErr.RetryAfter)*time.Second)
+		}
+		if tgErr.Code == http.StatusBadRequest || tgErr.Code == http.StatusForbidden {
+			return Permanent(err)
+		}
+	}
+	return err
+}
+
+// Queues the event for every subscribed chat following the event's account.
+func (t *telegram) Notify(ctx context.Context, event *Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []string
+	for chatID, sub := range t.subscriptions {
+		if addr, ok := event.AccountAddress(); ok && !sub.follows(addr) {
+			continue
+		}
+		// The owner may have been removed from config.yaml.
+		if owner := sub.owner(); owner != 0 && t.auth.role(owner) == "" {
+			continue
+		}
+		if err := t.queues[chatID].Push(event); err != nil {
+			errs = append(errs, fmt.Sprintf("chat %d: %v", chatID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Minimal role required for each command, commands missing here are unknown.
+var telegramCommandRoles = map[string]string{
+	"start":       TelegramRoleViewer,
+	"help":        TelegramRoleViewer,
+	"subscribe":   TelegramRoleViewer,
+	"unsubscribe": TelegramRoleViewer,
+	"accounts":    TelegramRoleViewer,
+	"balance":     TelegramRoleViewer,
+	"portfolio":   TelegramRoleViewer,
+	"history":     TelegramRoleViewer,
+	"status":      TelegramRoleViewer,
+	"allow":       TelegramRoleAdmin,
+	"revoke":      TelegramRoleAdmin,
+	"users":       TelegramRoleAdmin,
 }
 
 func (t *telegram) updatesLoop() {
@@ -63,38 +269,262 @@ func (t *telegram) updatesLoop() {
 
 	for {
 		select {
-		case <-t.stopCh:
+		case <-t.ctx.Done():
 			return
 		case update := <-updates:
-			if update.Message == nil {
+			if update.Message == nil || update.Message.From == nil || !update.Message.IsCommand() {
 				continue
 			}
-			log.Printf("Received message from %s: `%s`", update.Message.From.UserName, update.Message.Text)
-			if t.username != "" && update.Message.From.UserName != t.username {
-				continue
+			log.Printf("Received message from %s (ID %d): `%s`", update.Message.From, update.Message.From.ID, update.Message.Text)
+			// Slow commands, e.g. /portfolio, must not hold up the others.
+			select {
+			case <-t.ctx.Done():
+				return
+			case t.commandSlots <- struct{}{}:
 			}
-			if update.Message.Text == "/subscribe" {
-				t.chatID = update.Message.Chat.ID
-				t.subscribed.Store(true)
+			t.waitStop.Add(1)
+			go func(message *tgbotapi.Message) {
+				defer t.waitStop.Done()
+				defer func() { <-t.commandSlots }()
+				t.reply(message, t.authorizeCommand(message))
+			}(update.Message)
+		}
+	}
+}
+
+// Sends the reply text, split into several messages if it's too long for one.
+func (t *telegram) reply(message *tgbotapi.Message, text string) {
+	if text == "" {
+		return
+	}
+	for _, part := range splitTelegramReply(text, TelegramMaxMessageLength, TelegramMaxReplyMessages) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, part)
+		if _, err := t.bot.Send(msg); err != nil {
+			log.Printf("Failed to reply to Telegram chat %d: %v", message.Chat.ID, err)
+			return
+		}
+	}
+}
+
+const telegramTruncated = "…"
+
+// Splits the text at line breaks into messages within maxLength,
+// the text is truncated if it takes more than maxMessages messages.
+func splitTelegramReply(text string, maxLength, maxMessages int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		for telegramLength(line) > maxLength {
+			cut := telegramCut(line, maxLength)
+			lines = append(lines, line[:cut])
+			line = line[cut:]
+		}
+		lines = append(lines, line)
+	}
+
+	var messages, message []string
+	length := 0
+	for _, line := range lines {
+		n := telegramLength(line)
+		if len(message) > 0 && length+1+n > maxLength {
+			messages = append(messages, strings.Join(message, "\n"))
+			message, length = nil, 0
+		}
+		if len(message) > 0 {
+			length++
+		}
+		message = append(message, line)
+		length += n
+	}
+	messages = append(messages, strings.Join(message, "\n"))
+
+	if len(messages) > maxMessages {
+		messages = messages[:maxMessages]
+		last := messages[maxMessages-1]
+		if maxLength := maxLength - 1 - telegramLength(telegramTruncated); telegramLength(last) > maxLength {
+			last = last[:telegramCut(last, maxLength)]
+		}
+		messages[maxMessages-1] = last + "\n" + telegramTruncated
+	}
+	return messages
+}
+
+// Returns the byte length of the longest prefix of the text within maxLength.
+func telegramCut(text string, maxLength int) int {
+	length := 0
+	for i, r := range text {
+		if length += len(utf16.Encode([]rune{r})); length > maxLength {
+			return i
+		}
+	}
+	return len(text)
+}
+
+// Checks the sender's role and returns the reply text for the command.
+func (t *telegram) authorizeCommand(message *tgbotapi.Message) string {
+	if message.Command() == "pair" {
+		if !t.auth.pair(message.From, message.CommandArguments()) {
+			return "Invalid pairing code."
+		}
+		return "You are paired as admin!"
+	}
 
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "You are subscribed!")
-				t.bot.Send(msg)
+	required, known := telegramCommandRoles[message.Command()]
+	role := t.auth.role(message.From.ID)
+	if role == "" {
+		log.Printf("Ignoring command of unauthorized Telegram user %s (ID %d)", message.From, message.From.ID)
+		return fmt.Sprintf("You are not authorized. Ask an admin to run /allow %d", message.From.ID)
+	}
+	if !known {
+		return ""
+	}
+	if !telegramRoleAllows(role, required) {
+		return "This command requires the " + required + " role."
+	}
+	return t.handleCommand(message)
+}
 
-				log.Printf("Telegram Bot subscribed: %s", update.Message.From)
+// Handles the command and returns the reply text.
+func (t *telegram) handleCommand(message *tgbotapi.Message) string {
+	args := strings.Fields(message.CommandArguments())
+	switch message.Command() {
+	case "subscribe":
+		return t.subscribe(message, args)
+	case "unsubscribe":
+		return t.unsubscribe(message, args)
+	case "accounts":
+		return t.accountsCommand()
+	case "balance":
+		return t.balanceCommand(args)
+	case "portfolio":
+		return t.portfolioCommand(args)
+	case "history":
+		return t.historyCommand(args)
+	case "status":
+		return t.statusCommand()
+	case "allow":
+		return t.allowCommand(args)
+	case "revoke":
+		return t.revokeCommand(args)
+	case "users":
+		return t.usersCommand()
+	case "start", "help":
+		return telegramHelp
+	}
+	return ""
+}
+
+// Resolves account aliases or addresses given as command arguments.
+func (t *telegram) resolveAccounts(args []string) ([]common.Address, error) {
+	accounts := t.backend.Accounts()
+	addrs := make([]common.Address, 0, len(args))
+	for _, arg := range args {
+		addr, ok := accounts.Find(arg)
+		if !ok {
+			return nil, fmt.Errorf("Unknown account: %s", arg)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func (t *telegram) describe(sub *telegramSubscription) string {
+	if len(sub.Accounts) == 0 {
+		return "all accounts"
+	}
+	accounts := t.backend.Accounts()
+	names := make([]string, 0, len(sub.Accounts))
+	for _, addr := range sub.Accounts {
+		names = append(names, accounts.Lookup(addr))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// /subscribe follows all accounts, /subscribe <account>... follows the given accounts only.
+func (t *telegram) subscribe(message *tgbotapi.Message, args []string) string {
+	addrs, err := t.resolveAccounts(args)
+	if err != nil {
+		return err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sub := &telegramSubscription{ChatID: message.Chat.ID, UserID: message.From.ID}
+	if len(addrs) > 0 {
+		// A chat following all accounts is narrowed down to the given ones.
+		if existing, has := t.subscriptions[message.Chat.ID]; has {
+			sub.Accounts = append(sub.Accounts, existing.Accounts...)
+		}
+		for _, addr := range addrs {
+			if !containsAddress(sub.Accounts, addr) {
+				sub.Accounts = append(sub.Accounts, addr)
 			}
-			if update.Message.Text == "/unsubscribe" {
-				t.subscribed.Store(false)
+		}
+	}
+	if err := t.saveSubscription(sub); err != nil {
+		log.Printf("Failed to save Telegram subscription: %v", err)
+		return "Failed to subscribe, please try again later."
+	}
 
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "You are unsubscribed.")
-				t.bot.Send(msg)
+	log.Printf("Telegram Bot subscribed chat %d by %s", message.Chat.ID, message.From)
+	return "You are subscribed to " + t.describe(sub) + "!"
+}
 
-				log.Printf("Telegram Bot unsubscribed: %s", update.Message.From)
+// /unsubscribe stops all notifications, /unsubscribe <account>... removes accounts from the chat filter.
+func (t *telegram) unsubscribe(message *tgbotapi.Message, args []string) string {
+	addrs, err := t.resolveAccounts(args)
+	if err != nil {
+		return err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	existing, has := t.subscriptions[message.Chat.ID]
+	if !has {
+		return "You are not subscribed."
+	}
+
+	if len(addrs) > 0 {
+		followed := existing.Accounts
+		if len(followed) == 0 {
+			for addr := range t.backend.Accounts() {
+				followed = append(followed, addr)
+			}
+		}
+		sub := &telegramSubscription{ChatID: message.Chat.ID, UserID: message.From.ID}
+		for _, addr := range followed {
+			if !containsAddress(addrs, addr) {
+				sub.Accounts = append(sub.Accounts, addr)
 			}
 		}
+		if len(sub.Accounts) > 0 {
+			if err := t.saveSubscription(sub); err != nil {
+				log.Printf("Failed to save Telegram subscription: %v", err)
+				return "Failed to unsubscribe, please try again later."
+			}
+			return "You are subscribed to " + t.describe(sub) + "."
+		}
+	}
+
+	if err := t.deleteSubscription(message.Chat.ID); err != nil {
+		log.Printf("Failed to delete Telegram subscription: %v", err)
+		return "Failed to unsubscribe, please try again later."
 	}
+
+	log.Printf("Telegram Bot unsubscribed chat %d by %s", message.Chat.ID, message.From)
+	return "You are unsubscribed."
 }
 
 func (t *telegram) Close() {
-	close(t.stopCh)
+	t.cancel()
+	t.bot.StopReceivingUpdates()
 	t.waitStop.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, queue := range t.queues {
+		queue.Close()
+	}
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/syndtr/goleveldb/leveldb"
+	"go.uber.org/atomic"
+)
+
+const (
+	TelegramRoleAdmin  = "admin"
+	TelegramRoleViewer = "viewer"
+
+	telegramUsersBucket = "telegram/users"
+	// Pairing code and failed pairing attempts per user, kept across config reloads and restarts.
+	telegramPairingBucket         = "telegram/pairing"
+	telegramPairingFailuresBucket = "telegram/pairing-failures"
+)
+
+var (
+	telegramPairingCodeKey = []byte("code")
+	// The pairing code printed last, so a config reload does not print it again.
+	shownPairingCode atomic.String
+)
+
+type TelegramUserConfig struct {
+	// Numeric Telegram user ID, the bot replies with it to unauthorized users.
+	ID   int64  `yaml:"id"`
+	Role string `yaml:"role"`
+}
+
+type telegramUser struct {
+	ID   int64
+	Role string
+}
+
+// Returns true if the role grants permissions of the required one.
+func telegramRoleAllows(role, required string) bool {
+	switch role {
+	case TelegramRoleAdmin:
+		return true
+	case TelegramRoleViewer:
+		return required == TelegramRoleViewer
+	}
+	return false
+}
+
+// telegramAuth authorizes bot users by numeric user ID.
+// Users come from the config and from the Store (paired or added via /allow).
+type telegramAuth struct {
+	store Store
+
+	mu          sync.Mutex
+	configured  map[int64]string
+	stored      map[int64]string
+	pairingCode string
+}
+
+func newTelegramAuth(config *TelegramConfig, store Store) (*telegramAuth, error) {
+	a := &telegramAuth{
+		store:      store,
+		configured: make(map[int64]string),
+		stored:     make(map[int64]string),
+	}
+	for _, user := range config.Users {
+		a.configured[user.ID] = user.Role
+	}
+	err := store.ForEach(telegramUsersBucket, func(key []byte, decode func(value interface{}) error) (bool, error) {
+		user := &telegramUser{}
+		if err := decode(user); err != nil {
+			return false, err
+		}
+		a.stored[user.ID] = user.Role
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if a.hasAdmin() {
+		if err := store.Delete(telegramPairingBucket, telegramPairingCodeKey); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	err = store.Get(telegramPairingBucket, telegramPairingCodeKey, &a.pairingCode)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		a.resetPairingCode()
+	} else if err != nil {
+		return nil, err
+	}
+	if a.pairingCode != "" && shownPairingCode.Load() != a.pairingCode {
+		shownPairingCode.Store(a.pairingCode)
+		log.Printf("No Telegram admin is configured. Send `/pair %s` to the bot to become admin.", a.pairingCode)
+	}
+	return a, nil
+}
+
+func (a *telegramAuth) hasAdmin() bool {
+	for _, users := range []map[int64]string{a.configured, a.stored} {
+		for _, role := range users {
+			if role == TelegramRoleAdmin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Generates a new one-time pairing code and saves it to the Store.
+func (a *telegramAuth) resetPairingCode() {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Failed to generate Telegram pairing code: %v", err)
+		return
+	}
+	a.pairingCode = base32.StdEncoding.EncodeToString(buf)
+	if err := a.store.Put(telegramPairingBucket, telegramPairingCodeKey, a.pairingCode); err != nil {
+		log.Printf("Failed to save Telegram pairing code: %v", err)
+	}
+}
+
+// Returns the user's role, empty for unauthorized users.
+func (a *telegramAuth) role(userID int64) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if role, has := a.configured[userID]; has {
+		return role
+	}
+	return a.stored[userID]
+}
+
+// Binds the user as admin if the code matches the pairing code.
+func (a *telegramAuth) pair(user *tgbotapi.User, code string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pairingCode == "" {
+		return false
+	}
+	var failed int
+	if err := a.store.Get(telegramPairingFailuresBucket, int64Key(user.ID), &failed); err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		log.Printf("Failed to read Telegram pairing attempts: %v", err)
+		return false
+	}
+	if failed >= TelegramMaxPairingAttempts {
+		return false
+	}
+	if !strings.EqualFold(code, a.pairingCode) {
+		failed++
+		if err := a.store.Put(telegramPairingFailuresBucket, int64Key(user.ID), failed); err != nil {
+			log.Printf("Failed to save Telegram pairing attempts: %v", err)
+		}
+		if failed >= TelegramMaxPairingAttempts {
+			log.Printf("Too many failed Telegram pairing attempts of %s (ID %d), the user can't pair anymore", user, user.ID)
+		}
+		return false
+	}
+
+	if err := a.save(user.ID, TelegramRoleAdmin); err != nil {
+		log.Printf("Failed to save Telegram admin: %v", err)
+		return false
+	}
+	a.pairingCode = ""
+	if err := a.store.Delete(telegramPairingBucket, telegramPairingCodeKey); err != nil {
+		log.Printf("Failed to delete Telegram pairing code: %v", err)
+	}
+	log.Printf("Telegram user %s (ID %d) is paired as admin", user, user.ID)
+	return true
+}
+
+func (a *telegramAuth) save(userID int64, role string) error {
+	if err := a.store.Put(telegramUsersBucket, int64Key(userID), &telegramUser{ID: userID, Role: role}); err != nil {
+		return err
+	}
+	a.stored[userID] = role
+	return nil
+}
+
+func (a *telegramAuth) allow(userID int64, role string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, has := a.configured[userID]; has {
+		return fmt.Errorf("User %d is configured in config.yaml and can't be changed", userID)
+	}
+	return a.save(userID, role)
+}
+
+func (a *telegramAuth) revoke(userID int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, has := a.configured[userID]; has {
+		return fmt.Errorf("User %d is configured in config.yaml and can't be revoked", userID)
+	}
+	if _, has := a.stored[userID]; !has {
+		return fmt.Errorf("User %d is not authorized", userID)
+	}
+	if err := a.store.Delete(telegramUsersBucket, int64Key(userID)); err != nil {
+		return err
+	}
+	delete(a.stored, userID)
+	return nil
+}
+
+func (a *telegramAuth) users() []*telegramUser {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	users := make([]*telegramUser, 0, len(a.configured)+len(a.stored))
+	for id, role := range a.stored {
+		if _, has := a.configured[id]; !has {
+			users = append(users, &telegramUser{ID: id, Role: role})
+		}
+	}
+	for id, role := range a.configured {
+		users = append(users, &telegramUser{ID: id, Role: role})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// /allow <user-id> [admin|viewer]
+func (t *telegram) allowCommand(args []string) string {
+	if len(args) == 0 || len(args) > 2 {
+		return "Usage: /allow <user-id> [admin|viewer]"
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || userID <= 0 {
+		return "Invalid user ID: " + args[0]
+	}
+	role := TelegramRoleViewer
+	if len(args) == 2 {
+		role = args[1]
+	}
+	if role != TelegramRoleAdmin && role != TelegramRoleViewer {
+		return "Role must be admin or viewer."
+	}
+	if err := t.auth.allow(userID, role); err != nil {
+		return err.Error()
+	}
+	log.Printf("Telegram user %d is allowed as %s", userID, role)
+	return fmt.Sprintf("User %d is allowed as %s.", userID, role)
+}
+
+// /revoke <user-id>
+func (t *telegram) revokeCommand(args []string) string {
+	if len(args) != 1 {
+		return "Usage: /revoke <user-id>"
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return "Invalid user ID: " + args[0]
+	}
+	if err := t.auth.revoke(userID); err != nil {
+		return err.Error()
+	}
+	t.deleteUserSubscriptions(userID)
+	log.Printf("Telegram user %d is revoked", userID)
+	return fmt.Sprintf("User %d is revoked.", userID)
+}
+
+// Deletes subscriptions of a revoked user, so the user's chats stop receiving notifications.
+func (t *telegram) deleteUserSubscriptions(userID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for chatID, sub := range t.subscriptions {
+		if sub.owner() != userID {
+			continue
+		}
+		if err := t.deleteSubscription(chatID); err != nil {
+			log.Printf("Failed to delete Telegram subscription of chat %d: %v", chatID, err)
+		}
+	}
+}
+
+func (t *telegram) usersCommand() string {
+	users := t.auth.users()
+	if len(users) == 0 {
+		return "No users."
+	}
+	lines := make([]string, 0, len(users))
+	for _, user := range users {
+		lines = append(lines, fmt.Sprintf("%d: %s", user.ID, user.Role))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestTelegramPairingAttemptsPerUser(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewStore("store")
+	defer store.Close()
+
+	auth, err := newTelegramAuth(&TelegramConfig{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := auth.pairingCode
+	stranger := &tgbotapi.User{ID: 1}
+	for i := 0; i < TelegramMaxPairingAttempts; i++ {
+		if auth.pair(stranger, "wrong") {
+			t.Fatal("paired with a wrong code")
+		}
+	}
+	if auth.pair(stranger, code) {
+		t.Error("user is paired after too many failed attempts")
+	}
+	if auth.pairingCode != code {
+		t.Error("failed attempts of one user reset the pairing code")
+	}
+
+	// Rebuilt by a config reload or a restart.
+	auth, err = newTelegramAuth(&TelegramConfig{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.pairingCode != code {
+		t.Error("pairing code changed after a reload")
+	}
+	if auth.pair(stranger, code) {
+		t.Error("failed attempts are forgotten after a reload")
+	}
+
+	owner := &tgbotapi.User{ID: 2}
+	if !auth.pair(owner, code) {
+		t.Fatal("owner is not paired")
+	}
+	if role := auth.role(owner.ID); role != TelegramRoleAdmin {
+		t.Errorf("owner role = %q", role)
+	}
+	if auth.pair(&tgbotapi.User{ID: 3}, code) {
+		t.Error("pairing code is reused")
+	}
+	if auth, err = newTelegramAuth(&TelegramConfig{}, store); err != nil {
+		t.Fatal(err)
+	}
+	if auth.pairingCode != "" {
+		t.Errorf("pairing code %q after pairing", auth.pairingCode)
+	}
+}
+
+func TestTelegramRevokeDeletesSubscriptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewStore("store")
+	defer store.Close()
+
+	auth, err := newTelegramAuth(&TelegramConfig{Users: []TelegramUserConfig{{ID: 1, Role: TelegramRoleAdmin}}}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.allow(2, TelegramRoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	tg := &telegram{
+		store:         store,
+		auth:          auth,
+		subscriptions: make(map[int64]*telegramSubscription),
+		queues:        make(map[int64]*deliveryQueue),
+	}
+	defer func() {
+		for _, queue := range tg.queues {
+			queue.Close()
+		}
+	}()
+	for _, sub := range []*telegramSubscription{
+		{ChatID: 1, UserID: 1},
+		{ChatID: 2, UserID: 2},
+		{ChatID: -100, UserID: 2},
+		{ChatID: -200, UserID: 1},
+	} {
+		if err := tg.saveSubscription(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if reply := tg.revokeCommand([]string{"2"}); reply != "User 2 is revoked." {
+		t.Fatalf("revoke replied %q", reply)
+	}
+	for chatID, want := range map[int64]bool{1: true, 2: false, -100: false, -200: true} {
+		if _, has := tg.subscriptions[chatID]; has != want {
+			t.Errorf("chat %d subscribed = %v, want %v", chatID, has, want)
+		}
+		if _, has := tg.queues[chatID]; has != want {
+			t.Errorf("chat %d queue = %v, want %v", chatID, has, want)
+		}
+	}
+
+	stored := 0
+	err = store.ForEach(telegramSubscriptionsBucket, func(key []byte, decode func(value interface{}) error) (bool, error) {
+		stored++
+		return true, nil
+	})
+	if err != nil || stored != 2 {
+		t.Errorf("%d stored subscriptions, %v, want 2", stored, err)
+	}
+}
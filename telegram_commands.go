@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const telegramHelp = `Commands:
+/subscribe [account...] - receive notifications for all or the given accounts
+/unsubscribe [account...] - stop notifications for all or the given accounts
+/accounts - list watched accounts
+/balance [account] - show ETH and token balances
+/portfolio [account...] - show non-zero balances of all tokens ever transferred
+/history [account] [count] - show latest transfers
+/status - show sync status
+/users - list authorized users (admin)
+/allow <user-id> [admin|viewer] - authorize a user (admin)
+/revoke <user-id> - revoke a user (admin)`
+
+func (t *telegram) accountsCommand() string {
+	accounts := t.backend.Accounts()
+	lines := make([]string, 0, len(accounts)+1)
+	lines = append(lines, fmt.Sprintf("Watching %d account(s):", len(accounts)))
+	for _, addr := range accounts.Sorted() {
+		lines = append(lines, fmt.Sprintf("%s: %s", accounts.Lookup(addr), addr.Hex()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *telegram) balanceCommand(args []string) string {
+	addrs, err := t.resolveAccounts(args)
+	if err != nil {
+		return err.Error()
+	}
+	accounts := t.backend.Accounts()
+	if len(addrs) == 0 {
+		addrs = accounts.Sorted()
+	}
+
+	ctx, cancel := context.WithTimeout(t.ctx, TelegramCommandTimeout)
+	defer cancel()
+
+	format := t.backend.AmountFormat()
+	var lines []string
+	for _, addr := range addrs {
+		lines = append(lines, accounts.Lookup(addr)+":")
+		for _, balance := range t.backend.Balances(ctx, addr) {
+			value := "N/A"
+			if balance.Err == nil {
+				value = balance.Token.FormatValue(balance.Value, format)
+				if len(balance.Fiat) > 0 {
+					value += " (≈ " + balance.Fiat.String() + ")"
+				}
+			}
+			lines = append(lines, "  "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *telegram) portfolioCommand(args []string) string {
+	addrs, err := t.resolveAccounts(args)
+	if err != nil {
+		return err.Error()
+	}
+	accounts := t.backend.Accounts()
+	if len(addrs) == 0 {
+		addrs = accounts.Sorted()
+	}
+
+	ctx, cancel := context.WithTimeout(t.ctx, TelegramCommandTimeout)
+	defer cancel()
+
+	format := t.backend.AmountFormat()
+	var lines []string
+	for _, addr := range addrs {
+		lines = append(lines, t.backend.Portfolio(ctx, addr).Lines(accounts.Lookup(addr), format)...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// /history [account] [count]
+func (t *telegram) historyCommand(args []string) string {
+	limit := TelegramHistoryLimit
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[len(args)-1]); err == nil {
+			if n <= 0 || n > TelegramHistoryMaxLimit {
+				return fmt.Sprintf("Count must be between 1 and %d.", TelegramHistoryMaxLimit)
+			}
+			limit = n
+			args = args[:len(args)-1]
+		}
+	}
+	if len(args) > 1 {
+		return "Usage: /history [account] [count]"
+	}
+	addrs, err := t.resolveAccounts(args)
+	if err != nil {
+		return err.Error()
+	}
+	var account *common.Address
+	if len(addrs) > 0 {
+		account = &addrs[0]
+	}
+
+	entries, err := t.backend.History().Latest(account, limit)
+	if err != nil {
+		return "Failed to read transfers history."
+	}
+	if len(entries) == 0 {
+		return "No transfers yet."
+	}
+
+	accounts := t.backend.Accounts()
+	format := t.backend.AmountFormat()
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		tr := entry.Transfer
+		value := tr.Token.FormatValue(&tr.Value, format)
+		var line string
+		if tr.Direction == Sent {
+			line = fmt.Sprintf("%s sent %s to %s", accounts.Lookup(tr.From), value, accounts.Lookup(tr.To))
+		} else {
+			line = fmt.Sprintf("%s received %s from %s", accounts.Lookup(tr.To), value, accounts.Lookup(tr.From))
+		}
+		lines = append(lines, entry.Time.Format("2006-01-02 15:04")+" "+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *telegram) statusCommand() string {
+	ctx, cancel := context.WithTimeout(t.ctx, TelegramCommandTimeout)
+	defer cancel()
+	report := t.backend.Status(ctx)
+
+	lines := []string{
+		"Up since: " + report.StartedAt.Format(time.RFC1123),
+	}
+	if report.LastBlock == 0 {
+		lines = append(lines, "Last block: none processed yet")
+	} else {
+		lines = append(lines, fmt.Sprintf("Last block: %d (%s ago)",
+			report.LastBlock, time.Since(report.LastBlockTime).Round(time.Second)))
+	}
+	if report.RpcError != nil {
+		lines = append(lines, fmt.Sprintf("RPC: unreachable (%v)", report.RpcError))
+	} else {
+		lines = append(lines,
+			fmt.Sprintf("Chain head: %d, lag: %d block(s)", report.HeadBlock, report.Lag()),
+			fmt.Sprintf("RPC: OK, latency %s", report.RpcLatency.Round(time.Millisecond)))
+	}
+	if report.LastError != nil {
+		lines = append(lines, fmt.Sprintf("Last RPC error: %v (%s ago)",
+			report.LastError, time.Since(report.LastErrorAt).Round(time.Second)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitTelegramReply(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"short", []string{"short"}},
+		{"aaaa\nbbbb\ncc", []string{"aaaa\nbbbb", "cc"}},
+		{"aaaaaaaaaaaaaaaaaaaaaaa", []string{"aaaaaaaaaa", "aaaaaaaaaa", "aaa"}},
+		// Emojis take two UTF-16 code units.
+		{"😀😀😀😀😀😀", []string{"😀😀😀😀😀", "😀"}},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17", []string{"1\n2\n3\n4\n5", "6\n7\n8\n9\n10", "11\n12\n13\n…"}},
+	}
+	for _, tt := range tests {
+		got := splitTelegramReply(tt.text, 10, 3)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("splitTelegramReply(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		for _, message := range got {
+			if telegramLength(message) > 10 {
+				t.Errorf("message %q is too long", message)
+			}
+		}
+	}
+}
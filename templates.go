@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Message templates per event kind, e.g. `sent: "{{ .Account }} sent {{ .Value }}"`.
+// Templates get the Event as data.
+type TemplatesConfig map[EventKind]string
+
+var defaultTemplates = TemplatesConfig{
+	EventSent:       `{{ escape .Account }} sent {{ escape .Value }}{{ with .Fiat }} (≈ {{ escape . }}){{ end }} to {{ escape .Counterparty }}, new balance: {{ escape .Balance }}`,
+	EventReceived:   `{{ escape .Account }} received {{ escape .Value }}{{ with .Fiat }} (≈ {{ escape . }}){{ end }} from {{ escape .Counterparty }}, new balance: {{ escape .Balance }}`,
+	EventStatus:     `{{ escape .Message }}`,
+	EventLowBalance: `{{ escape .Account }} balance is low: {{ escape .Balance }}, below {{ escape .Alert.Threshold.String }} {{ escape .Alert.Token.Symbol }}`,
+	EventBalanceChange: `{{ escape .Account }} {{ escape .Alert.Token.Symbol }} balance changed by {{ escape .Value }} more than observed transfers explain ` +
+		`(blocks {{ .Alert.FromBlock }}-{{ .Alert.Block }}), balance: {{ escape .Balance }}`,
+}
+
+// Event kinds which can have templates.
+var templateEventKinds = []EventKind{EventSent, EventReceived, EventFailed, EventApproval, EventReorg, EventStatus, EventLowBalance, EventBalanceChange}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+	">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`)
+
+func escapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// Escapes text for Telegram MarkdownV2.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// MessageTemplates renders event messages for a single sink.
+type MessageTemplates struct {
+	templates map[EventKind]*template.Template
+	escape    func(string) string
+}
+
+// NewMessageTemplates parses default templates overridden by the global config templates
+// and then by the sink templates. The escape func is applied by the `escape` template func.
+func NewMessageTemplates(config *Config, sinkTemplates TemplatesConfig, escape func(string) string) (*MessageTemplates, error) {
+	explorer := NewExplorer(config)
+	accounts := NewAccounts(config)
+	funcs := template.FuncMap{
+		"escape":         escape,
+		"escapeHTML":     escapeHTML,
+		"escapeMarkdown": escapeMarkdown,
+		"txUrl":          explorer.TxUrl,
+		"addressUrl":     explorer.AddressUrl,
+		"tokenUrl":       explorer.TokenUrl,
+		"alias":          accounts.Lookup,
+		"address":        func(addr common.Address) string { return addr.Hex() },
+	}
+
+	t := &MessageTemplates{
+		templates: make(map[EventKind]*template.Template),
+		escape:    escape,
+	}
+	for _, texts := range []TemplatesConfig{defaultTemplates, config.Templates, sinkTemplates} {
+		for kind, text := range texts {
+			tmpl, err := template.New(string(kind)).Funcs(funcs).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("template %s: %w", kind, err)
+			}
+			t.templates[kind] = tmpl
+		}
+	}
+	return t, nil
+}
+
+// Render returns the event message rendered by the template of the event kind.
+// Falls back to the escaped event.Message if there is no template or rendering fails.
+func (t *MessageTemplates) Render(event *Event) string {
+	tmpl, has := t.templates[event.Kind]
+	if !has {
+		return t.escape(event.Message)
+	}
+	buf := &strings.Builder{}
+	if err := tmpl.Execute(buf, event); err != nil {
+		log.Printf("Failed to render %s template: %v", event.Kind, err)
+		return t.escape(event.Message)
+	}
+	return buf.String()
+}
+
+// RenderWithWarnings renders the event message prefixed by a line per event warning,
+// for notifiers which have no better way to highlight them.
+func (t *MessageTemplates) RenderWithWarnings(event *Event) string {
+	message := t.Render(event)
+	for i := len(event.Warnings) - 1; i >= 0; i-- {
+		message = WarningSign + " " + t.escape(event.Warnings[i]) + "\n" + message
+	}
+	return message
+}
+
+func noEscape(s string) string {
+	return s
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMessageTemplatesFallback(t *testing.T) {
+	templates, err := NewMessageTemplates(&Config{}, TemplatesConfig{
+		// Fails on events without an alert.
+		EventLowBalance: "{{ .Alert.Token.Symbol }} is low",
+	}, escapeHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		event *Event
+		want  string
+	}{
+		{&Event{Kind: EventLowBalance, Message: "<b>low</b> & more"}, "&lt;b&gt;low&lt;/b&gt; &amp; more"},
+		// No template for the kind.
+		{&Event{Kind: EventKind("unknown"), Message: "a < b"}, "a &lt; b"},
+		{NewStatusEvent("1 < 2"), "1 &lt; 2"},
+	}
+	for _, tt := range tests {
+		if got := templates.Render(tt.event); got != tt.want {
+			t.Errorf("Render(%s %q) = %q, want %q", tt.event.Kind, tt.event.Message, got, tt.want)
+		}
+	}
+}
@@ -14,6 +14,10 @@ import (
 type TokensDB interface {
 	AddToken(token *Token) error
 	GetToken(addr common.Address) (*Token, error)
+	// Failed lookups are kept apart from tokens, GetFailure returns nil if there is none.
+	AddFailure(addr common.Address, failure *Failure) error
+	GetFailure(addr common.Address) (*Failure, error)
+	DeleteFailure(addr common.Address) error
 	Close()
 }
 
@@ -45,6 +49,7 @@ func (tdb *tokensDB) Close() {
 
 type tokenDTO struct {
 	Symbol   string
+	Name     string
 	Decimals uint8
 }
 
@@ -55,6 +60,7 @@ func (tdb tokensDB) AddToken(token *Token) error {
 
 	dto := tokenDTO{
 		Symbol:   token.Symbol,
+		Name:     token.Name,
 		Decimals: token.Decimals,
 	}
 
@@ -86,6 +92,53 @@ func (tdb tokensDB) GetToken(addr common.Address) (*Token, error) {
 	return &Token{
 		Address:  addr,
 		Symbol:   dto.Symbol,
+		Name:     dto.Name,
 		Decimals: dto.Decimals,
 	}, nil
 }
+
+// Failures are stored under a prefix, plain address keys are tokens.
+func failureKey(addr common.Address) []byte {
+	return append([]byte("failure/"), addr.Bytes()...)
+}
+
+func (tdb tokensDB) AddFailure(addr common.Address, failure *Failure) error {
+	if tdb.db == nil {
+		log.Panicln("Failed to AddFailure on closed TokensDB")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(failure); err != nil {
+		return err
+	}
+
+	return tdb.db.Put(failureKey(addr), buf.Bytes(), nil)
+}
+
+func (tdb tokensDB) GetFailure(addr common.Address) (*Failure, error) {
+	if tdb.db == nil {
+		log.Panicln("Failed to GetFailure on closed TokensDB")
+	}
+
+	value, err := tdb.db.Get(failureKey(addr), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var failure Failure
+	if err := gob.NewDecoder(bytes.NewBuffer(value)).Decode(&failure); err != nil {
+		return nil, err
+	}
+	return &failure, nil
+}
+
+func (tdb tokensDB) DeleteFailure(addr common.Address) error {
+	if tdb.db == nil {
+		log.Panicln("Failed to DeleteFailure on closed TokensDB")
+	}
+
+	return tdb.db.Delete(failureKey(addr), nil)
+}
@@ -0,0 +1,77 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// How long contracts without ERC-20 metadata are remembered before they are checked again.
+	NotTokenRetryAfter = 24 * time.Hour
+	// How long lookups failed for other reasons, e.g. RPC timeouts, are remembered.
+	LookupRetryAfter = time.Minute
+)
+
+// LookupError reports a failed token lookup.
+type LookupError struct {
+	Address common.Address
+	// Set when the contract does not implement ERC-20 metadata, unset for failures like RPC timeouts.
+	NotToken bool
+	Reason   string
+	// Set when the failure is remembered from an earlier lookup.
+	Cached bool
+}
+
+func (e *LookupError) Error() string {
+	if e.NotToken {
+		return fmt.Sprintf("%s is not an ERC-20 token: %s", e.Address.Hex(), e.Reason)
+	}
+	return fmt.Sprintf("lookup of token %s failed: %s", e.Address.Hex(), e.Reason)
+}
+
+// Failure is a failed token lookup remembered until Until.
+type Failure struct {
+	NotToken bool
+	Reason   string
+	At       time.Time
+	Until    time.Time
+}
+
+func newFailure(err error, now time.Time) *Failure {
+	f := &Failure{Reason: err.Error(), At: now, Until: now.Add(LookupRetryAfter)}
+	var notToken *notTokenError
+	if errors.As(err, &notToken) {
+		f.NotToken = true
+		f.Until = now.Add(NotTokenRetryAfter)
+	}
+	return f
+}
+
+func (f *Failure) err(addr common.Address, cached bool) *LookupError {
+	return &LookupError{Address: addr, NotToken: f.NotToken, Reason: f.Reason, Cached: cached}
+}
+
+// Marks errors caused by the contract itself rather than by the lookup.
+type notTokenError struct {
+	err error
+}
+
+func (e *notTokenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notTokenError) Unwrap() error {
+	return e.err
+}
+
+// Classifies the error of a metadata call, only transport errors mean the contract may still be a token.
+func metadataError(method string, result CallResult, err error) error {
+	err = fmt.Errorf("%s: %w", method, err)
+	if result.Err != nil && !errors.Is(result.Err, ErrCallReverted) {
+		return err
+	}
+	return &notTokenError{err: err}
+}
@@ -0,0 +1,248 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Format describes how token amounts are rendered.
+type Format struct {
+	// Max number of fraction digits, rounded half up. Negative means all digits, i.e. exact value.
+	Precision int
+	// Keeps trailing fraction zeros up to Precision.
+	KeepZeros    bool
+	ThousandsSep string
+	DecimalSep   string
+	// Renders values of a thousand and more with K, M, B and T suffixes, e.g. 1.2M.
+	// Compact values are rounded to Precision digits, one if Precision is negative.
+	Compact bool
+}
+
+// DefaultFormat renders exact values with comma thousands separators, e.g. 1,523.44.
+var DefaultFormat = Format{
+	Precision:    -1,
+	ThousandsSep: ",",
+	DecimalSep:   ".",
+}
+
+var localeFormats = map[string]Format{
+	"en":    DefaultFormat,
+	"de":    {Precision: -1, ThousandsSep: ".", DecimalSep: ","},
+	"fr":    {Precision: -1, ThousandsSep: " ", DecimalSep: ","},
+	"ch":    {Precision: -1, ThousandsSep: "'", DecimalSep: "."},
+	"plain": {Precision: -1, DecimalSep: "."},
+}
+
+// LocaleFormat returns the format with separators of the given locale:
+// "en" (1,234.5), "de" (1.234,5), "fr" (1 234,5), "ch" (1'234.5) or "plain" (1234.5).
+func LocaleFormat(locale string) (Format, error) {
+	f, has := localeFormats[strings.ToLower(locale)]
+	if !has {
+		return Format{}, fmt.Errorf("unknown locale %q", locale)
+	}
+	return f, nil
+}
+
+var compactSuffixes = []string{"", "K", "M", "B", "T"}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// FormatAmount renders amount of the smallest units of a token with the given decimals.
+// It works on integers only, so the result is exact up to the format precision.
+func FormatAmount(amount *big.Int, decimals int, f Format) string {
+	abs := new(big.Int).Abs(amount)
+
+	suffix := 0
+	precision := f.Precision
+	if f.Compact {
+		if precision < 0 {
+			precision = 1
+		}
+		for suffix+1 < len(compactSuffixes) && abs.Cmp(pow10(decimals+3*(suffix+1))) >= 0 {
+			suffix++
+		}
+	}
+
+	var units *big.Int
+	scale := decimals + 3*suffix
+	for {
+		units, scale = round(abs, decimals+3*suffix, precision)
+		// Rounding may carry over to the next suffix, e.g. 999.96K is 1M.
+		if !f.Compact || suffix+1 == len(compactSuffixes) || units.Cmp(new(big.Int).Mul(big.NewInt(1000), pow10(scale))) < 0 {
+			break
+		}
+		suffix++
+	}
+
+	digits := units.String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	intPart, fracPart := digits[:len(digits)-scale], digits[len(digits)-scale:]
+	if !f.KeepZeros {
+		fracPart = strings.TrimRight(fracPart, "0")
+	}
+
+	b := &strings.Builder{}
+	if amount.Sign() < 0 && units.Sign() != 0 {
+		b.WriteByte('-')
+	}
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(f.ThousandsSep)
+		}
+		b.WriteRune(digit)
+	}
+	if fracPart != "" {
+		decimalSep := f.DecimalSep
+		if decimalSep == "" {
+			decimalSep = "."
+		}
+		b.WriteString(decimalSep)
+		b.WriteString(fracPart)
+	}
+	b.WriteString(compactSuffixes[suffix])
+	return b.String()
+}
+
+// Rounds value with the given number of fraction digits half up to precision digits,
+// returns the rounded value and its number of fraction digits.
+func round(value *big.Int, scale, precision int) (*big.Int, int) {
+	if precision < 0 || precision >= scale {
+		return value, scale
+	}
+	divisor := pow10(scale - precision)
+	q, r := new(big.Int).QuoRem(value, divisor, new(big.Int))
+	if r.Lsh(r, 1).Cmp(divisor) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return q, precision
+}
+
+// Decimal is an exact decimal number Value * 10^-Scale.
+type Decimal struct {
+	Value *big.Int
+	Scale int
+}
+
+var compactMultipliers = map[byte]int{'K': 3, 'k': 3, 'M': 6, 'B': 9, 'T': 12}
+
+// ParseDecimal parses decimal numbers like "1523.44", "-0.5", "1,000,000", "1_000" or compact "1.5M".
+// Commas and underscores are accepted as thousands separators of 3-digit groups only, so "0,5" is rejected.
+// The decimal separator is always a dot.
+func ParseDecimal(s string) (*Decimal, error) {
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "-"), "+")
+
+	shift := 0
+	if n := len(str); n > 0 {
+		if exp, has := compactMultipliers[str[n-1]]; has {
+			shift, str = exp, str[:n-1]
+		}
+	}
+
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	intPart, ok := ungroup(intPart)
+	if !ok || (intPart == "" && fracPart == "") {
+		return nil, fmt.Errorf("%q is not a decimal number", s)
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return nil, fmt.Errorf("%q is not a decimal number", s)
+			}
+		}
+	}
+
+	value, _ := new(big.Int).SetString(intPart+fracPart+"0", 10)
+	value.Quo(value, big.NewInt(10))
+	if neg {
+		value.Neg(value)
+	}
+	d := &Decimal{Value: value, Scale: len(fracPart) - shift}
+	if d.Scale < 0 {
+		d.Value.Mul(d.Value, pow10(-d.Scale))
+		d.Scale = 0
+	}
+	return d, nil
+}
+
+// Removes thousands separators, all groups but the first must have exactly 3 digits.
+// Returns false if the separators are misplaced.
+func ungroup(s string) (string, bool) {
+	i := strings.IndexAny(s, ",_")
+	if i < 0 {
+		return s, true
+	}
+	groups := strings.Split(s, s[i:i+1])
+	if len(groups[0]) == 0 || len(groups[0]) > 3 {
+		return "", false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+var errTooPrecise = errors.New("has more fraction digits than the token")
+
+// Units converts the decimal to the smallest units of a token with the given decimals.
+// Fails if the decimal has non-zero digits beyond the token decimals.
+func (d *Decimal) Units(decimals int) (*big.Int, error) {
+	if d.Scale <= decimals {
+		return new(big.Int).Mul(d.Value, pow10(decimals-d.Scale)), nil
+	}
+	q, r := new(big.Int).QuoRem(d.Value, pow10(d.Scale-decimals), new(big.Int))
+	if r.Sign() != 0 {
+		return nil, errTooPrecise
+	}
+	return q, nil
+}
+
+// CmpAmount compares amount of smallest token units with the decimal, returns -1, 0 or +1
+// when the amount is less than, equal to or greater than the decimal.
+func (d *Decimal) CmpAmount(amount *big.Int, decimals int) int {
+	a, b := amount, d.Value
+	if d.Scale > decimals {
+		a = new(big.Int).Mul(amount, pow10(d.Scale-decimals))
+	} else {
+		b = new(big.Int).Mul(d.Value, pow10(decimals-d.Scale))
+	}
+	return a.Cmp(b)
+}
+
+func (d *Decimal) Sign() int {
+	return d.Value.Sign()
+}
+
+func (d *Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Value, pow10(d.Scale))
+}
+
+// String renders the exact value without thousands separators.
+func (d *Decimal) String() string {
+	return FormatAmount(d.Value, d.Scale, localeFormats["plain"])
+}
+
+// ParseAmount parses a decimal number to the smallest units of a token with the given decimals.
+func ParseAmount(s string, decimals int) (*big.Int, error) {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		return nil, err
+	}
+	units, err := d.Units(decimals)
+	if err != nil {
+		return nil, fmt.Errorf("%q %w", s, err)
+	}
+	return units, nil
+}
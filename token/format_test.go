@@ -0,0 +1,140 @@
+package token
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatAmount(t *testing.T) {
+	de, _ := LocaleFormat("de")
+	fr, _ := LocaleFormat("fr")
+	plain, _ := LocaleFormat("plain")
+	precision := func(f Format, p int) Format {
+		f.Precision = p
+		return f
+	}
+	keepZeros := precision(DefaultFormat, 4)
+	keepZeros.KeepZeros = true
+	compact := DefaultFormat
+	compact.Compact = true
+
+	tests := []struct {
+		amount   string
+		decimals int
+		format   Format
+		want     string
+	}{
+		{"0", 18, DefaultFormat, "0"},
+		{"1", 18, DefaultFormat, "0.000000000000000001"},
+		{"1523440000", 6, DefaultFormat, "1,523.44"},
+		{"-1523440000", 6, DefaultFormat, "-1,523.44"},
+		{"1000000000000000000000000", 18, DefaultFormat, "1,000,000"},
+		{"123", 0, DefaultFormat, "123"},
+		{"1234567891", 6, de, "1.234,567891"},
+		{"1234567891", 6, fr, "1\u202f234,567891"},
+		{"1234567891", 6, plain, "1234.567891"},
+		{"1234567891", 6, precision(DefaultFormat, 2), "1,234.57"},
+		{"1234564999", 6, precision(DefaultFormat, 2), "1,234.56"},
+		{"1234565000", 6, precision(DefaultFormat, 2), "1,234.57"},
+		{"1999999", 6, precision(DefaultFormat, 2), "2"},
+		{"1500000", 6, precision(DefaultFormat, 0), "2"},
+		{"1499999", 6, precision(DefaultFormat, 0), "1"},
+		{"-4000", 6, precision(DefaultFormat, 2), "0"},
+		{"1500000", 6, keepZeros, "1.5000"},
+		{"1500000", 6, precision(DefaultFormat, 8), "1.5"},
+		{"999000000", 6, compact, "999"},
+		{"1000000000", 6, compact, "1K"},
+		{"1250000000000", 6, compact, "1.3M"},
+		{"999960000000", 6, compact, "1M"},
+		{"999960000000", 6, precision(compact, 2), "999.96K"},
+		{"2500000000000000000", 6, compact, "2.5T"},
+		{"2500000000000000000000", 6, compact, "2,500T"},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		if got := FormatAmount(amount, tt.decimals, tt.format); got != tt.want {
+			t.Errorf("FormatAmount(%s, %d, %+v) = %q, want %q", tt.amount, tt.decimals, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in    string
+		value string
+		scale int
+	}{
+		{"0", "0", 0},
+		{"1523.44", "152344", 2},
+		{"-0.5", "-5", 1},
+		{"+2", "2", 0},
+		{".5", "5", 1},
+		{"5.", "5", 0},
+		{" 42 ", "42", 0},
+		{"1,000,000", "1000000", 0},
+		{"12,345.678", "12345678", 3},
+		{"1_000", "1000", 0},
+		{"1.5M", "1500000", 0},
+		{"2K", "2000", 0},
+		{"1.2345K", "12345", 1},
+		{"3B", "3000000000", 0},
+		{"1,500K", "1500000", 0},
+	}
+	for _, tt := range tests {
+		d, err := ParseDecimal(tt.in)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q): %v", tt.in, err)
+			continue
+		}
+		if d.Value.String() != tt.value || d.Scale != tt.scale {
+			t.Errorf("ParseDecimal(%q) = %s×10^-%d, want %s×10^-%d", tt.in, d.Value, d.Scale, tt.value, tt.scale)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"-",
+		".",
+		"abc",
+		"1.2.3",
+		"1e6",
+		"0,5",
+		"1,5",
+		"1,0000",
+		",100",
+		"1000,000",
+		"1,000_000",
+		"1__000",
+		"100,",
+		"0.000,001",
+		"1.5X",
+	} {
+		if d, err := ParseDecimal(in); err == nil {
+			t.Errorf("ParseDecimal(%q) = %s×10^-%d, want error", in, d.Value, d.Scale)
+		}
+	}
+}
+
+func TestDecimalUnits(t *testing.T) {
+	tests := []struct {
+		in       string
+		decimals int
+		want     string
+	}{
+		{"1.5", 6, "1500000"},
+		{"1.50", 1, "15"},
+		{"100", 0, "100"},
+		{"0.000001", 6, "1"},
+	}
+	for _, tt := range tests {
+		d, _ := ParseDecimal(tt.in)
+		got, err := d.Units(tt.decimals)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s.Units(%d) = %v, %v, want %s", tt.in, tt.decimals, got, err, tt.want)
+		}
+	}
+	d, _ := ParseDecimal("0.0000001")
+	if _, err := d.Units(6); err == nil {
+		t.Error("too precise value is converted")
+	}
+}
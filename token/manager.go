@@ -1,96 +1,416 @@
 package token
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"log"
 	"math/big"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/andrei-toptal/eth-listener/token/erc20"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/sync/singleflight"
 )
 
+// Max number of cached historical balances.
+const BalanceCacheSize = 4096
+
+var erc20ABI, _ = erc20.ERC20MetaData.GetAbi()
+
 type TokensManager interface {
-	// Returns token for the given contract address or error.
-	// For unknown tokens this fetches token details from the contract.
-	// NOT THREAD SAFE
+	// Returns token for the given contract address or error, ErrBlocked for blocklisted contracts.
+	// For unknown tokens this fetches token details from the contract,
+	// registered details take precedence over the contract ones.
 	GetToken(ctx context.Context, contractAddress common.Address) (*Token, error)
-	// Returns token's balance for the given address or error.
+	// Replaces registered tokens and the blocklist, cached tokens are resolved again.
+	SetRegistry(registry *Registry)
+	// Returns token's current balance for the given address or error.
 	FetchBalance(ctx context.Context, token *Token, addr common.Address) (*big.Int, error)
+	// Returns token's balance for the given address right after the block with the given hash or error.
+	// The block is looked up by hash (EIP-1898), so a reorg never yields the balance at its replacement.
+	FetchBalanceAt(ctx context.Context, token *Token, addr common.Address, blockHash common.Hash) (*big.Int, error)
+	// Returns balances for all requests at the given block, the latest one if block is nil.
+	// Lookups are batched, so this is much cheaper than fetching balances one by one.
+	FetchBalances(ctx context.Context, requests []BalanceRequest, block *big.Int) []BalanceResult
+}
+
+type BalanceRequest struct {
+	Token *Token
+	Addr  common.Address
+}
+
+type BalanceResult struct {
+	Value *big.Int
+	Err   error
+}
+
+type balanceKey struct {
+	token common.Address
+	addr  common.Address
+	block common.Hash
 }
 
 type tokensManager struct {
-	client *ethclient.Client
-	tdb    TokensDB
-	tokens map[common.Address]*Token
+	batcher *Batcher
+	tdb     TokensDB
+
+	lookups  singleflight.Group
+	mu       sync.Mutex
+	registry *Registry
+	tokens   map[common.Address]*Token
+	failures map[common.Address]*Failure
+	// Failures before a registry change are retried, it may change the outcome.
+	retryBefore time.Time
+
+	balancesMu sync.Mutex
+	balances   map[balanceKey]*big.Int
+	// Cached keys in insertion order, the oldest are evicted first.
+	balanceKeys []balanceKey
 }
 
-func NewTokensManager(client *ethclient.Client, tdb TokensDB) TokensManager {
+func NewTokensManager(rpcClient *rpc.Client, client *ethclient.Client, tdb TokensDB) TokensManager {
+	return &tokensManager{
+		batcher:  NewBatcher(rpcClient, client),
+		tdb:      tdb,
+		registry: NewRegistry(),
+		tokens:   newTokensCache(),
+		failures: make(map[common.Address]*Failure),
+		balances: make(map[balanceKey]*big.Int),
+	}
+}
+
+func newTokensCache() map[common.Address]*Token {
 	tokens := make(map[common.Address]*Token)
 	tokens[ETHToken.Address] = ETHToken
+	return tokens
+}
 
-	return &tokensManager{
-		client: client,
-		tdb:    tdb,
-		tokens: tokens,
+func (tm *tokensManager) SetRegistry(registry *Registry) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if len(tm.tokens) > 1 || len(tm.failures) > 0 {
+		tm.retryBefore = time.Now()
 	}
+	tm.registry = registry
+	tm.tokens = newTokensCache()
+	tm.failures = make(map[common.Address]*Failure)
 }
 
 func (tm *tokensManager) GetToken(ctx context.Context, contractAddress common.Address) (*Token, error) {
-	if t, has := tm.tokens[contractAddress]; has {
-		return t, nil
-	}
+	tm.mu.Lock()
+	registry := tm.registry
+	t, has := tm.tokens[contractAddress]
+	tm.mu.Unlock()
 
-	t, err := tm.tdb.GetToken(contractAddress)
-	if err == nil {
-		tm.tokens[contractAddress] = t
+	if registry.Blocked(contractAddress) {
+		return nil, ErrBlocked
+	}
+	if has {
 		return t, nil
 	}
 
-	token, err := erc20.NewERC20(contractAddress, tm.client)
+	// The lock is not held during the lookup, concurrent lookups of the same token share one.
+	v, err, _ := tm.lookups.Do(contractAddress.Hex(), func() (interface{}, error) {
+		return tm.lookupToken(ctx, contractAddress, registry)
+	})
 	if err != nil {
-		tm.tokens[contractAddress] = nil // remember as non-ERC20 token
 		return nil, err
 	}
-	decimals, err := token.Decimals(&bind.CallOpts{})
-	if err != nil {
-		tm.tokens[contractAddress] = nil // remember as non-ERC20 token
-		return nil, err
+	return v.(*Token), nil
+}
+
+func (tm *tokensManager) lookupToken(ctx context.Context, contractAddress common.Address, registry *Registry) (*Token, error) {
+	info := registry.tokens[contractAddress]
+	if t := info.token(); t != nil {
+		tm.cacheToken(registry, t)
+		return t, nil
 	}
-	symbol, err := token.Symbol(&bind.CallOpts{})
+
+	t, err := tm.tdb.GetToken(contractAddress)
 	if err != nil {
-		tm.tokens[contractAddress] = nil // remember as non-ERC20 token
-		return nil, err
+		if f := tm.failure(registry, contractAddress); f != nil {
+			return nil, f.err(contractAddress, true)
+		}
+
+		var standard bool
+		t, standard, err = tm.fetchToken(ctx, contractAddress, info, registry)
+		if err != nil {
+			f := newFailure(err, time.Now())
+			tm.setFailure(registry, contractAddress, f)
+			if err := tm.tdb.AddFailure(contractAddress, f); err != nil {
+				log.Printf("Failed to store token lookup failure: %v", err)
+			}
+			return nil, f.err(contractAddress, false)
+		}
+		// Only details read from the contract are stored, registered and default ones may change.
+		if info == nil && standard {
+			if err := tm.tdb.AddToken(t); err != nil {
+				return nil, err
+			}
+		}
+		if tm.setFailure(registry, contractAddress, nil) {
+			if err := tm.tdb.DeleteFailure(contractAddress); err != nil {
+				log.Printf("Failed to delete token lookup failure: %v", err)
+			}
+		}
 	}
-	if symbol == "" {
-		tm.tokens[contractAddress] = nil // remember as non-ERC20 token
-		return nil, errors.New("empty token symbol, ignoring as malformed token")
+
+	t = info.apply(t)
+	tm.cacheToken(registry, t)
+	return t, nil
+}
+
+// Caches the token unless the registry it was resolved with has been replaced meanwhile.
+func (tm *tokensManager) cacheToken(registry *Registry, t *Token) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if tm.registry == registry {
+		tm.tokens[t.Address] = t
 	}
+}
 
-	t = &Token{
-		Address:  contractAddress,
-		Symbol:   symbol,
-		Decimals: decimals,
+// Remembers the failure, nil forgets it. Returns true if there was a failure remembered before.
+func (tm *tokensManager) setFailure(registry *Registry, addr common.Address, f *Failure) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	had := tm.failures[addr] != nil
+	if tm.registry == registry {
+		if f != nil {
+			tm.failures[addr] = f
+		} else {
+			delete(tm.failures, addr)
+		}
 	}
+	return had
+}
 
-	if err := tm.tdb.AddToken(t); err != nil {
-		return nil, err
+// Returns the remembered failure of the token lookup, nil if there is none or it has expired.
+func (tm *tokensManager) failure(registry *Registry, addr common.Address) *Failure {
+	tm.mu.Lock()
+	f, has := tm.failures[addr]
+	tm.mu.Unlock()
+	if !has {
+		stored, err := tm.tdb.GetFailure(addr)
+		if err != nil {
+			log.Printf("Failed to read token lookup failure: %v", err)
+		}
+		f = stored
+		tm.mu.Lock()
+		if tm.registry == registry {
+			tm.failures[addr] = f
+		}
+		tm.mu.Unlock()
 	}
 
-	tm.tokens[contractAddress] = t
+	tm.mu.Lock()
+	retryBefore := tm.retryBefore
+	tm.mu.Unlock()
+	if f == nil || time.Now().After(f.Until) || f.At.Before(retryBefore) {
+		return nil
+	}
+	return f
+}
 
-	return t, nil
+// Fetches token details missing in info from the contract in a single batch.
+// Returns false if the contract lacks decimals() and the registry's default decimals apply.
+func (tm *tokensManager) fetchToken(ctx context.Context, contractAddress common.Address, info *TokenInfo, registry *Registry) (*Token, bool, error) {
+	t := &Token{Address: contractAddress}
+	var methods []string
+	if info == nil || info.Decimals == nil {
+		methods = append(methods, "decimals")
+	}
+	if info == nil || info.Symbol == "" {
+		methods = append(methods, "symbol")
+	}
+	if info == nil || info.Name == "" {
+		methods = append(methods, "name")
+	}
+
+	calls := make([]Call, len(methods))
+	for i, method := range methods {
+		data, err := erc20ABI.Pack(method)
+		if err != nil {
+			return nil, false, err
+		}
+		calls[i] = Call{Target: contractAddress, Data: data}
+	}
+	results := tm.batcher.Call(ctx, calls, nil)
+
+	standard := true
+	for i, result := range results {
+		switch methods[i] {
+		case "decimals":
+			decimals, err := unpackDecimals(result)
+			if err != nil {
+				err = metadataError("decimals", result, err)
+				// Transport errors say nothing about the contract.
+				var notToken *notTokenError
+				if registry.DefaultDecimals == nil || !errors.As(err, &notToken) {
+					return nil, false, err
+				}
+				decimals, standard = *registry.DefaultDecimals, false
+			}
+			t.Decimals = decimals
+		case "symbol":
+			symbol, err := unpackString("symbol", result)
+			if err != nil {
+				return nil, false, metadataError("symbol", result, err)
+			}
+			if symbol == "" {
+				return nil, false, &notTokenError{err: errors.New("empty token symbol, ignoring as malformed token")}
+			}
+			t.Symbol = symbol
+		case "name":
+			// The name is optional in ERC-20.
+			t.Name, _ = unpackString("name", result)
+		}
+	}
+
+	return t, standard, nil
+}
+
+func unpackDecimals(result CallResult) (uint8, error) {
+	if result.Err != nil {
+		return 0, result.Err
+	}
+	out, err := erc20ABI.Unpack("decimals", result.Data)
+	if err != nil {
+		return 0, err
+	}
+	return *abi.ConvertType(out[0], new(uint8)).(*uint8), nil
+}
+
+// Decodes string results, falling back to bytes32 returned by older tokens like MKR.
+func unpackString(method string, result CallResult) (string, error) {
+	if result.Err != nil {
+		return "", result.Err
+	}
+	out, err := erc20ABI.Unpack(method, result.Data)
+	if err == nil {
+		return strings.TrimSpace(*abi.ConvertType(out[0], new(string)).(*string)), nil
+	}
+	if len(result.Data) != 32 {
+		return "", err
+	}
+	value := string(bytes.TrimRight(result.Data, "\x00"))
+	if !utf8.ValidString(value) || strings.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return "", fmt.Errorf("bytes32 %s is not printable text", method)
+	}
+	return strings.TrimSpace(value), nil
 }
 
 func (tm *tokensManager) FetchBalance(ctx context.Context, token *Token, addr common.Address) (*big.Int, error) {
-	if token == ETHToken {
-		return tm.client.PendingBalanceAt(ctx, addr)
+	r := tm.FetchBalances(ctx, []BalanceRequest{{Token: token, Addr: addr}}, nil)[0]
+	return r.Value, r.Err
+}
+
+func (tm *tokensManager) FetchBalanceAt(ctx context.Context, token *Token, addr common.Address, blockHash common.Hash) (*big.Int, error) {
+	key := balanceKey{token: token.Address, addr: addr, block: blockHash}
+	if balance, has := tm.cachedBalance(key); has {
+		return balance, nil
+	}
+	var balance *big.Int
+	if token.Address == ETHToken.Address {
+		var err error
+		if balance, err = tm.batcher.BalanceAtHash(ctx, addr, blockHash); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := erc20ABI.Pack("balanceOf", addr)
+		if err != nil {
+			return nil, err
+		}
+		res := tm.batcher.CallAtHash(ctx, Call{Target: token.Address, Data: data}, blockHash)
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		if balance, err = unpackUint256("balanceOf", res.Data); err != nil {
+			return nil, err
+		}
+	}
+	tm.cacheBalance(key, balance)
+	return balance, nil
+}
+
+func (tm *tokensManager) FetchBalances(ctx context.Context, requests []BalanceRequest, block *big.Int) []BalanceResult {
+	results := make([]BalanceResult, len(requests))
+
+	var ethAddrs []common.Address
+	var ethIdx []int
+	var calls []Call
+	var callIdx []int
+	for i, r := range requests {
+		if r.Token.Address == ETHToken.Address {
+			ethAddrs = append(ethAddrs, r.Addr)
+			ethIdx = append(ethIdx, i)
+			continue
+		}
+		data, err := erc20ABI.Pack("balanceOf", r.Addr)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		calls = append(calls, Call{Target: r.Token.Address, Data: data})
+		callIdx = append(callIdx, i)
+	}
+
+	if len(ethAddrs) > 0 {
+		balances, errs := tm.batcher.Balances(ctx, ethAddrs, block)
+		for j, i := range ethIdx {
+			results[i] = BalanceResult{Value: balances[j], Err: errs[j]}
+		}
+	}
+	if len(calls) > 0 {
+		for j, res := range tm.batcher.Call(ctx, calls, block) {
+			i := callIdx[j]
+			if res.Err != nil {
+				results[i].Err = res.Err
+				continue
+			}
+			results[i].Value, results[i].Err = unpackUint256("balanceOf", res.Data)
+		}
 	}
 
-	erc20t, err := erc20.NewERC20(token.Address, tm.client)
+	return results
+}
+
+func (tm *tokensManager) cachedBalance(key balanceKey) (*big.Int, bool) {
+	tm.balancesMu.Lock()
+	defer tm.balancesMu.Unlock()
+	balance, has := tm.balances[key]
+	if !has {
+		return nil, false
+	}
+	return new(big.Int).Set(balance), true
+}
+
+func (tm *tokensManager) cacheBalance(key balanceKey, balance *big.Int) {
+	tm.balancesMu.Lock()
+	defer tm.balancesMu.Unlock()
+	if _, has := tm.balances[key]; has {
+		return
+	}
+	if len(tm.balanceKeys) >= BalanceCacheSize {
+		delete(tm.balances, tm.balanceKeys[0])
+		tm.balanceKeys = tm.balanceKeys[1:]
+	}
+	tm.balances[key] = new(big.Int).Set(balance)
+	tm.balanceKeys = append(tm.balanceKeys, key)
+}
+
+func unpackUint256(method string, data []byte) (*big.Int, error) {
+	out, err := erc20ABI.Unpack(method, data)
 	if err != nil {
 		return nil, err
 	}
-	return erc20t.BalanceOf(&bind.CallOpts{}, addr)
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
 }
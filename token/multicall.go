@@ -0,0 +1,200 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/andrei-toptal/eth-listener/token/multicall"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/atomic"
+)
+
+// Multicall3 is deployed at the same address on most EVM chains.
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// JSON-RPC error code of reverted eth_call, see EIP-1474.
+const RevertErrorCode = 3
+
+// Max number of calls aggregated into a single Multicall3 call or JSON-RPC batch.
+const MaxBatchSize = 200
+
+// ErrCallReverted is returned for calls failed by the contract, e.g. missing methods.
+var ErrCallReverted = errors.New("execution reverted")
+
+// Call is a single contract call, Data is the ABI encoded input.
+type Call struct {
+	Target common.Address
+	Data   []byte
+}
+
+type CallResult struct {
+	Data []byte
+	Err  error
+}
+
+// Batcher aggregates calls at the same block into Multicall3 calls and
+// ETH balance lookups into JSON-RPC batches. Where Multicall3 is not deployed
+// calls are made one by one.
+type Batcher struct {
+	rpc       *rpc.Client
+	client    *ethclient.Client
+	multicall *multicall.Multicall3Caller
+	// Set once Multicall3 turns out to be missing on the chain.
+	unavailable atomic.Bool
+}
+
+func NewBatcher(rpcClient *rpc.Client, client *ethclient.Client) *Batcher {
+	b := &Batcher{
+		rpc:    rpcClient,
+		client: client,
+	}
+	caller, err := multicall.NewMulticall3Caller(Multicall3Address, client)
+	if err != nil {
+		b.unavailable.Store(true) // never happens with a valid ABI
+	}
+	b.multicall = caller
+	return b
+}
+
+// Call executes all calls at the given block, the latest one if block is nil.
+// Results are in the order of calls, failed calls do not affect the others.
+func (b *Batcher) Call(ctx context.Context, calls []Call, block *big.Int) []CallResult {
+	results := make([]CallResult, len(calls))
+	for start := 0; start < len(calls); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		if !b.aggregate(ctx, calls[start:end], block, results[start:end]) {
+			b.callEach(ctx, calls[start:end], block, results[start:end])
+		}
+	}
+	return results
+}
+
+// Returns false if the calls could not be aggregated and have to be made one by one.
+func (b *Batcher) aggregate(ctx context.Context, calls []Call, block *big.Int, results []CallResult) bool {
+	if len(calls) < 2 || b.unavailable.Load() {
+		return false
+	}
+
+	calls3 := make([]multicall.Multicall3Call3, len(calls))
+	for i, c := range calls {
+		calls3[i] = multicall.Multicall3Call3{Target: c.Target, AllowFailure: true, CallData: c.Data}
+	}
+	out, err := b.multicall.Aggregate3(&bind.CallOpts{Context: ctx, BlockNumber: block}, calls3)
+	if err != nil || len(out) != len(calls) {
+		// Either the RPC failed or Multicall3 is not there (yet, for old blocks).
+		// Only the latest state tells whether it is worth trying again.
+		if ctx.Err() == nil {
+			if code, err := b.client.CodeAt(ctx, Multicall3Address, nil); err == nil && len(code) == 0 {
+				b.unavailable.Store(true)
+			}
+		}
+		return false
+	}
+	for i, r := range out {
+		if r.Success {
+			results[i] = CallResult{Data: r.ReturnData}
+		} else {
+			results[i] = CallResult{Err: ErrCallReverted}
+		}
+	}
+	return true
+}
+
+func (b *Batcher) callEach(ctx context.Context, calls []Call, block *big.Int, results []CallResult) {
+	for i, c := range calls {
+		target := c.Target
+		data, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &target, Data: c.Data}, block)
+		if isRevert(err) {
+			if err.Error() == ErrCallReverted.Error() {
+				err = ErrCallReverted
+			} else {
+				err = fmt.Errorf("%w: %v", ErrCallReverted, err)
+			}
+		}
+		results[i] = CallResult{Data: data, Err: err}
+	}
+}
+
+// Reports whether the node failed the call because the contract reverted.
+// Other node errors, e.g. rate limits or missing state, say nothing about the contract.
+func isRevert(err error) bool {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	return rpcErr.ErrorCode() == RevertErrorCode || strings.Contains(strings.ToLower(err.Error()), "execution reverted")
+}
+
+// Balances returns ETH balances of the addresses at the given block, the latest one if block is nil.
+func (b *Batcher) Balances(ctx context.Context, addrs []common.Address, block *big.Int) ([]*big.Int, []error) {
+	balances := make([]*big.Int, len(addrs))
+	errs := make([]error, len(addrs))
+	blockArg := "latest"
+	if block != nil {
+		blockArg = hexutil.EncodeBig(block)
+	}
+
+	for start := 0; start < len(addrs); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(addrs) {
+			end = len(addrs)
+		}
+		values := make([]hexutil.Big, end-start)
+		batch := make([]rpc.BatchElem, end-start)
+		for i := range batch {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getBalance",
+				Args:   []interface{}{addrs[start+i], blockArg},
+				Result: &values[i],
+			}
+		}
+		if err := b.rpc.BatchCallContext(ctx, batch); err != nil {
+			for i := start; i < end; i++ {
+				errs[i] = err
+			}
+			continue
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				errs[start+i] = elem.Error
+			} else {
+				balances[start+i] = values[i].ToInt()
+			}
+		}
+	}
+	return balances, errs
+}
+
+// CallAtHash executes a single call at the block with the given hash (EIP-1898).
+func (b *Batcher) CallAtHash(ctx context.Context, call Call, blockHash common.Hash) CallResult {
+	var data hexutil.Bytes
+	arg := map[string]interface{}{
+		"to":   call.Target,
+		"data": hexutil.Bytes(call.Data),
+	}
+	err := b.rpc.CallContext(ctx, &data, "eth_call", arg, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	if isRevert(err) {
+		err = fmt.Errorf("%w: %v", ErrCallReverted, err)
+	}
+	return CallResult{Data: data, Err: err}
+}
+
+// BalanceAtHash returns the ETH balance of the address at the block with the given hash (EIP-1898).
+func (b *Batcher) BalanceAtHash(ctx context.Context, addr common.Address, blockHash common.Hash) (*big.Int, error) {
+	var balance hexutil.Big
+	if err := b.rpc.CallContext(ctx, &balance, "eth_getBalance", addr, rpc.BlockNumberOrHashWithHash(blockHash, false)); err != nil {
+		return nil, err
+	}
+	return balance.ToInt(), nil
+}
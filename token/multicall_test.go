@@ -0,0 +1,79 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Answers every JSON-RPC request with the given result and sends the request params to the returned channel.
+func fakeNode(t *testing.T, result string) (*Batcher, <-chan []json.RawMessage) {
+	t.Helper()
+	params := make(chan []json.RawMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("unexpected request: %s", body)
+		}
+		params <- req.Params
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"jsonrpc":"2.0","id":`+string(req.ID)+`,"result":`+result+`}`)
+	}))
+	t.Cleanup(server.Close)
+	client, err := rpc.DialHTTP(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return &Batcher{rpc: client}, params
+}
+
+func TestBalanceAtHash(t *testing.T) {
+	b, params := fakeNode(t, `"0x2a"`)
+	hash := common.HexToHash("0xabc")
+	balance, err := b.BalanceAtHash(context.Background(), common.HexToAddress("0x01"), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 42 {
+		t.Errorf("balance = %s", balance)
+	}
+	checkBlockHashParam(t, <-params, hash)
+}
+
+func TestCallAtHash(t *testing.T) {
+	b, params := fakeNode(t, `"0x01"`)
+	hash := common.HexToHash("0xabc")
+	res := b.CallAtHash(context.Background(), Call{Target: common.HexToAddress("0x01"), Data: []byte{1}}, hash)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(res.Data) != 1 || res.Data[0] != 1 {
+		t.Errorf("data = %x", res.Data)
+	}
+	checkBlockHashParam(t, <-params, hash)
+}
+
+func checkBlockHashParam(t *testing.T, params []json.RawMessage, hash common.Hash) {
+	t.Helper()
+	if len(params) != 2 {
+		t.Fatalf("params = %s", params)
+	}
+	var block struct {
+		BlockHash   *common.Hash `json:"blockHash"`
+		BlockNumber *string      `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(params[1], &block); err != nil || block.BlockHash == nil || *block.BlockHash != hash || block.BlockNumber != nil {
+		t.Errorf("block param = %s, want the block hash %s", params[1], hash.Hex())
+	}
+}
@@ -0,0 +1,108 @@
+package token
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var ErrBlocked = errors.New("token is blocklisted")
+
+// TokenInfo pre-registers token details, empty fields are read from the contract.
+type TokenInfo struct {
+	Address  common.Address
+	Symbol   string
+	Name     string
+	Decimals *uint8
+}
+
+// Returns the token if all required details are known, nil otherwise.
+func (info *TokenInfo) token() *Token {
+	if info == nil || info.Symbol == "" || info.Decimals == nil {
+		return nil
+	}
+	return &Token{
+		Address:  info.Address,
+		Symbol:   info.Symbol,
+		Name:     info.Name,
+		Decimals: *info.Decimals,
+	}
+}
+
+// Returns a copy of the token with the registered details.
+func (info *TokenInfo) apply(t *Token) *Token {
+	if info == nil {
+		return t
+	}
+	overridden := *t
+	if info.Symbol != "" {
+		overridden.Symbol = info.Symbol
+	}
+	if info.Name != "" {
+		overridden.Name = info.Name
+	}
+	if info.Decimals != nil {
+		overridden.Decimals = *info.Decimals
+	}
+	return &overridden
+}
+
+// Registry holds token details known upfront and contracts to ignore.
+type Registry struct {
+	tokens  map[common.Address]*TokenInfo
+	blocked map[common.Address]bool
+	// Decimals of tokens without decimals(), such tokens are skipped when nil.
+	DefaultDecimals *uint8
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tokens:  make(map[common.Address]*TokenInfo),
+		blocked: make(map[common.Address]bool),
+	}
+}
+
+// Add registers the token, non-empty fields override the ones added before.
+func (r *Registry) Add(info *TokenInfo) {
+	existing, has := r.tokens[info.Address]
+	if !has {
+		copied := *info
+		r.tokens[info.Address] = &copied
+		return
+	}
+	if info.Symbol != "" {
+		existing.Symbol = info.Symbol
+	}
+	if info.Name != "" {
+		existing.Name = info.Name
+	}
+	if info.Decimals != nil {
+		decimals := *info.Decimals
+		existing.Decimals = &decimals
+	}
+}
+
+func (r *Registry) Block(addr common.Address) {
+	r.blocked[addr] = true
+}
+
+func (r *Registry) Blocked(addr common.Address) bool {
+	return r.blocked[addr]
+}
+
+// Addresses returns addresses of the registered tokens with the given symbol, case-insensitive.
+func (r *Registry) Addresses(symbol string) []common.Address {
+	var addrs []common.Address
+	for addr, info := range r.tokens {
+		if info.Symbol != "" && strings.EqualFold(info.Symbol, symbol) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Len returns the number of registered tokens.
+func (r *Registry) Len() int {
+	return len(r.tokens)
+}
@@ -1,16 +1,16 @@
 package token
 
 import (
-	"fmt"
-	"math"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
 type Token struct {
-	Address  common.Address
-	Symbol   string
+	Address common.Address
+	Symbol  string
+	// Display name, may be empty.
+	Name     string
 	Decimals uint8
 }
 
@@ -19,10 +19,16 @@ type Token struct {
 var ETHToken = &Token{
 	Address:  common.HexToAddress("0x0"),
 	Symbol:   "ETH",
+	Name:     "Ether",
 	Decimals: 18,
 }
 
+// RenderValue renders the exact value with the token symbol using DefaultFormat.
 func (t Token) RenderValue(value *big.Int) string {
-	val := new(big.Float).Quo(new(big.Float).SetInt(value), big.NewFloat(math.Pow10(int(t.Decimals))))
-	return fmt.Sprintf("%s %s", val.String(), t.Symbol)
+	return t.FormatValue(value, DefaultFormat)
+}
+
+// FormatValue renders the value with the token symbol, e.g. "1,523.44 USDT".
+func (t Token) FormatValue(value *big.Int, f Format) string {
+	return FormatAmount(value, int(t.Decimals), f) + " " + t.Symbol
 }
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Token list in the format of https://tokenlists.org, only the fields used by the app.
+type tokenList struct {
+	Name   string           `json:"name"`
+	Tokens []tokenListEntry `json:"tokens"`
+}
+
+type tokenListEntry struct {
+	ChainId  uint64 `json:"chainId"`
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals *uint8 `json:"decimals"`
+}
+
+// LoadTokenList reads a Uniswap-style token list file and returns its tokens of the given chain.
+func LoadTokenList(path string, chainId uint64) ([]*TokenInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list tokenList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var tokens []*TokenInfo
+	for i, entry := range list.Tokens {
+		if entry.ChainId != chainId {
+			continue
+		}
+		if !common.IsHexAddress(entry.Address) {
+			return nil, fmt.Errorf("%s: tokens[%d]: invalid address %q", path, i, entry.Address)
+		}
+		if entry.Symbol == "" || entry.Decimals == nil {
+			return nil, fmt.Errorf("%s: tokens[%d]: symbol and decimals are required", path, i)
+		}
+		tokens = append(tokens, &TokenInfo{
+			Address:  common.HexToAddress(entry.Address),
+			Symbol:   entry.Symbol,
+			Name:     entry.Name,
+			Decimals: entry.Decimals,
+		})
+	}
+	return tokens, nil
+}
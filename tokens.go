@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type TokenConfig struct {
+	Address string `yaml:"address"`
+	Symbol  string `yaml:"symbol"`
+	// Display name.
+	Name     string `yaml:"name"`
+	Decimals *uint8 `yaml:"decimals"`
+}
+
+type TokensConfig struct {
+	// Chain of the token list entries to import and of the spam filter's well-known tokens, mainnet by default.
+	ChainId uint64 `yaml:"chain-id"`
+	// Uniswap-style token list files, see https://tokenlists.org.
+	Lists []string `yaml:"lists"`
+	// Tokens whose balances are tracked for every account, with optional details overriding the contract ones.
+	Tracked []TokenConfig `yaml:"tracked"`
+	// Contracts whose transfers are ignored.
+	Blocklist []string `yaml:"blocklist"`
+	// Decimals of tokens without decimals(), such tokens are skipped by default.
+	DefaultDecimals *uint8 `yaml:"default-decimals"`
+}
+
+func (c *TokensConfig) chainId() uint64 {
+	if c.ChainId == 0 {
+		return DefaultChainId
+	}
+	return c.ChainId
+}
+
+// Returns the chain the listener is configured for, mainnet by default.
+func configChainId(config *Config) uint64 {
+	if config.Tokens == nil {
+		return DefaultChainId
+	}
+	return config.Tokens.chainId()
+}
+
+// NewTokenRegistry returns tokens registered by the config.
+// Tracked tokens take precedence over token lists, later lists over earlier ones.
+func NewTokenRegistry(config *Config) (*token.Registry, error) {
+	registry := token.NewRegistry()
+	if config.Tokens == nil {
+		return registry, nil
+	}
+
+	for _, path := range config.Tokens.Lists {
+		tokens, err := token.LoadTokenList(path, config.Tokens.chainId())
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range tokens {
+			registry.Add(info)
+		}
+	}
+	for _, tc := range config.Tokens.Tracked {
+		registry.Add(&token.TokenInfo{
+			Address:  common.HexToAddress(tc.Address),
+			Symbol:   tc.Symbol,
+			Name:     tc.Name,
+			Decimals: tc.Decimals,
+		})
+	}
+	for _, addr := range config.Tokens.Blocklist {
+		registry.Block(common.HexToAddress(addr))
+	}
+	registry.DefaultDecimals = config.Tokens.DefaultDecimals
+	return registry, nil
+}
+
+// Returns addresses of the tokens tracked by the config.
+func trackedTokenAddresses(config *Config) []common.Address {
+	if config.Tokens == nil {
+		return nil
+	}
+	addrs := make([]common.Address, 0, len(config.Tokens.Tracked))
+	for _, tc := range config.Tokens.Tracked {
+		addrs = append(addrs, common.HexToAddress(tc.Address))
+	}
+	return addrs
+}
@@ -15,9 +15,34 @@ const (
 )
 
 type Transfer struct {
-	Direction Direction
-	From      common.Address
-	To        common.Address
-	Value     big.Int
-	Token     *token.Token
+	Direction   Direction
+	From        common.Address
+	To          common.Address
+	Value       big.Int
+	Token       *token.Token
+	TxHash      common.Hash
+	BlockNumber uint64
+	BlockHash   common.Hash
+	// Reasons why the transfer looks like spam or scam, see SpamFilter.
+	Suspicious []string
+	// Known counterparty imitated by the transfer counterparty, set on suspected address poisoning.
+	LookalikeOf *common.Address
+	// Value in fiat currencies at the time the transfer was handled, nil if prices are not configured.
+	Fiat FiatValues
+}
+
+// Account returns the address of the watched account involved in the transfer.
+func (t *Transfer) Account() common.Address {
+	if t.Direction == Sent {
+		return t.From
+	}
+	return t.To
+}
+
+// Counterparty returns the address of the other side of the transfer.
+func (t *Transfer) Counterparty() common.Address {
+	if t.Direction == Sent {
+		return t.To
+	}
+	return t.From
 }
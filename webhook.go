@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+)
+
+type WebhookConfig struct {
+	// Identifies the webhook in logs and its pending deliveries, derived from the URL by default.
+	Name    string            `yaml:"name"`
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// When set, the request body is signed with HMAC-SHA256 using this secret.
+	Secret          string        `yaml:"secret"`
+	SignatureHeader string        `yaml:"signature-header"`
+	Timeout         time.Duration `yaml:"timeout"`
+	Retry           RetryConfig   `yaml:"retry"`
+}
+
+type webhookToken struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name,omitempty"`
+	Decimals uint8  `json:"decimals"`
+}
+
+type webhookTransfer struct {
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Value       string       `json:"value"`
+	Token       webhookToken `json:"token"`
+	TxHash      string       `json:"tx_hash"`
+	BlockNumber uint64       `json:"block_number"`
+	// Known counterparty imitated by the counterparty, set on suspected address poisoning.
+	LookalikeOf string `json:"lookalike_of,omitempty"`
+	// Value per fiat currency, e.g. {"USD": "1523.44"}.
+	Fiat map[string]string `json:"fiat,omitempty"`
+}
+
+type webhookAlert struct {
+	Account    string       `json:"account"`
+	Token      webhookToken `json:"token"`
+	Block      uint64       `json:"block_number"`
+	Balance    string       `json:"balance"`
+	Threshold  string       `json:"threshold,omitempty"`
+	FromBlock  uint64       `json:"from_block_number,omitempty"`
+	Difference string       `json:"difference,omitempty"`
+}
+
+type webhookPayload struct {
+	Kind         EventKind        `json:"kind"`
+	Time         time.Time        `json:"time"`
+	Severity     string           `json:"severity,omitempty"`
+	Message      string           `json:"message"`
+	Account      string           `json:"account,omitempty"`
+	Counterparty string           `json:"counterparty,omitempty"`
+	Value        string           `json:"value,omitempty"`
+	Balance      string           `json:"balance,omitempty"`
+	BalanceFiat  string           `json:"balance_fiat,omitempty"`
+	Warnings     []string         `json:"warnings,omitempty"`
+	Transfer     *webhookTransfer `json:"transfer,omitempty"`
+	Alert        *webhookAlert    `json:"alert,omitempty"`
+}
+
+func newWebhookToken(t *token.Token) webhookToken {
+	return webhookToken{
+		Address:  t.Address.Hex(),
+		Symbol:   t.Symbol,
+		Name:     t.Name,
+		Decimals: t.Decimals,
+	}
+}
+
+func newWebhookPayload(event *Event) *webhookPayload {
+	payload := &webhookPayload{
+		Kind:         event.Kind,
+		Time:         event.Time,
+		Severity:     event.Severity,
+		Message:      event.Message,
+		Account:      event.Account,
+		Counterparty: event.Counterparty,
+		Value:        event.Value,
+		Balance:      event.Balance,
+		BalanceFiat:  event.BalanceFiat,
+		Warnings:     event.Warnings,
+	}
+	if t := event.Transfer; t != nil {
+		payload.Transfer = &webhookTransfer{
+			From:        t.From.Hex(),
+			To:          t.To.Hex(),
+			Value:       t.Value.String(),
+			Token:       newWebhookToken(t.Token),
+			TxHash:      t.TxHash.Hex(),
+			BlockNumber: t.BlockNumber,
+			Fiat:        t.Fiat.Strings(),
+		}
+		if t.LookalikeOf != nil {
+			payload.Transfer.LookalikeOf = t.LookalikeOf.Hex()
+		}
+	}
+	if a := event.Alert; a != nil {
+		payload.Alert = &webhookAlert{
+			Account:   a.Account.Hex(),
+			Token:     newWebhookToken(a.Token),
+			Block:     a.Block,
+			Balance:   a.Balance.String(),
+			FromBlock: a.FromBlock,
+		}
+		if a.Threshold != nil {
+			payload.Alert.Threshold = a.Threshold.String()
+		}
+		if a.Difference != nil {
+			payload.Alert.Difference = a.Difference.String()
+		}
+	}
+	return payload
+}
+
+type webhook struct {
+	config *WebhookConfig
+	client *http.Client
+	queue  *deliveryQueue
+}
+
+// NewWebhook creates a notifier posting events as JSON to the configured URL.
+// Events are queued in the Store and retried with backoff until delivered.
+func NewWebhook(config *WebhookConfig, store Store) Notifier {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	w := &webhook{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+	}
+	w.queue = newDeliveryQueue(store, deliveryQueueConfig{
+		Name:  w.Name(),
+		Retry: config.Retry,
+		Send: func(ctx context.Context, events []*Event) error {
+			return w.post(ctx, events[0])
+		},
+	})
+	return w
+}
+
+// The URL may carry secrets, so it is never logged or used as a bucket name.
+func (w *webhook) Name() string {
+	if w.config.Name != "" {
+		return "webhook " + w.config.Name
+	}
+	hash := sha256.Sum256([]byte(w.config.Url))
+	return "webhook " + hex.EncodeToString(hash[:6])
+}
+
+func (w *webhook) Notify(ctx context.Context, event *Event) error {
+	return w.queue.Push(event)
+}
+
+func (w *webhook) Close() {
+	w.queue.Close()
+}
+
+// Returns the signature header value for the given body: sha256=<hex hmac>.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *webhook) post(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(newWebhookPayload(event))
+	if err != nil {
+		return Permanent(err)
+	}
+
+	headers := make(map[string]string, len(w.config.Headers)+1)
+	for name, value := range w.config.Headers {
+		headers[name] = value
+	}
+	if w.config.Secret != "" {
+		header := w.config.SignatureHeader
+		if header == "" {
+			header = DefaultWebhookSignatureHeader
+		}
+		headers[header] = signWebhookBody(w.config.Secret, body)
+	}
+
+	return postJSON(ctx, w.client, w.config.Url, headers, body)
+}
+
+// Posts the JSON body to the given URL.
+// Client errors (4xx except 408 and 429) are reported as permanent,
+// 429 responses respect the Retry-After header.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected response status %s", resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, convErr := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); convErr == nil && seconds > 0 {
+			return RetryAfter(err, time.Duration(seconds*float64(time.Second)))
+		}
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-toptal/eth-listener/token"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func testTransferEvent() *Event {
+	transfer := &Transfer{
+		Direction:   Received,
+		From:        common.HexToAddress("0x00000000000000000000000000000000000000b2"),
+		To:          common.HexToAddress("0x00000000000000000000000000000000000000a1"),
+		Token:       token.ETHToken,
+		TxHash:      common.HexToHash("0x01"),
+		BlockNumber: 14_000_000,
+	}
+	transfer.Value.SetUint64(1_500_000_000_000_000_000)
+	return &Event{
+		Kind:         EventReceived,
+		Time:         time.Date(2022, 4, 23, 9, 28, 10, 0, time.UTC),
+		Account:      "Main",
+		Counterparty: "Exchange",
+		Value:        "1.5 ETH",
+		Balance:      "2 ETH",
+		Message:      "Main received 1.5 ETH from Exchange",
+		Transfer:     transfer,
+	}
+}
+
+func TestWebhookPost(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	w := &webhook{
+		config: &WebhookConfig{
+			Url:     server.URL,
+			Headers: map[string]string{"Authorization": "Bearer token"},
+			Secret:  "secret",
+		},
+		client: server.Client(),
+	}
+	if err := w.post(context.Background(), testTransferEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got, want := header.Get(DefaultWebhookSignatureHeader), signWebhookBody("secret", body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Kind != EventReceived || payload.Account != "Main" || payload.Transfer == nil {
+		t.Fatalf("unexpected payload: %s", body)
+	}
+	if payload.Transfer.Value != "1500000000000000000" || payload.Transfer.Token.Symbol != "ETH" || payload.Transfer.BlockNumber != 14_000_000 {
+		t.Errorf("unexpected transfer: %s", body)
+	}
+}
+
+func TestWebhookPostErrors(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		permanent  bool
+		after      time.Duration
+	}{
+		{status: http.StatusBadRequest, permanent: true},
+		{status: http.StatusNotFound, permanent: true},
+		{status: http.StatusRequestTimeout},
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusTooManyRequests, retryAfter: "30", after: 30 * time.Second},
+		{status: http.StatusInternalServerError},
+		{status: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.retryAfter != "" {
+				w.Header().Set("Retry-After", tt.retryAfter)
+			}
+			w.WriteHeader(tt.status)
+		}))
+		w := &webhook{config: &WebhookConfig{Url: server.URL}, client: server.Client()}
+		err := w.post(context.Background(), testTransferEvent())
+		server.Close()
+
+		if err == nil {
+			t.Errorf("status %d: no error", tt.status)
+			continue
+		}
+		var permanent *permanentError
+		if got := errors.As(err, &permanent); got != tt.permanent {
+			t.Errorf("status %d: permanent = %v, want %v", tt.status, got, tt.permanent)
+		}
+		var retryAfter *retryAfterError
+		if errors.As(err, &retryAfter) != (tt.after > 0) || (retryAfter != nil && retryAfter.after != tt.after) {
+			t.Errorf("status %d: unexpected retry delay: %v", tt.status, err)
+		}
+	}
+}
+
+func TestWebhookName(t *testing.T) {
+	url := "https://example.com/hook?key=secret"
+	name := (&webhook{config: &WebhookConfig{Url: url}}).Name()
+	if strings.Contains(name, "secret") || strings.Contains(name, "example.com") {
+		t.Errorf("name %q reveals the URL", name)
+	}
+	if other := (&webhook{config: &WebhookConfig{Url: url + "2"}}).Name(); other == name {
+		t.Errorf("different URLs share the name %q", name)
+	}
+	if got := (&webhook{config: &WebhookConfig{Name: "backend", Url: url}}).Name(); got != "webhook backend" {
+		t.Errorf("configured name = %q", got)
+	}
+}
@@ -5,18 +5,32 @@ package main
 import (
 	"github.com/andrei-toptal/eth-listener/token"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/google/wire"
 )
 
-func newEthClient(config *Config) (*ethclient.Client, error) {
-	return ethclient.Dial(config.EthUrl)
+func newRPCClient(config *Config) (*rpc.Client, error) {
+	return rpc.Dial(config.EthUrl)
+}
+
+func newEthClient(rpcClient *rpc.Client) *ethclient.Client {
+	return ethclient.NewClient(rpcClient)
 }
 
 func newTokensDB() token.TokensDB {
 	return token.NewTokensDB(TokensDBPath)
 }
 
+func newStore() Store {
+	return NewStore(StoreDBPath)
+}
+
 func WireApp(configPath string) (*App, error) {
-	wire.Build(NewApp, LoadConfig, NewAccounts, NewTelegram, newEthClient, newTokensDB, token.NewTokensManager)
+	wire.Build(NewApp, LoadConfig, NewAccounts, NewHistory, NewCounterparties, NewAccountTokens, newRPCClient, newEthClient, newTokensDB, newStore, token.NewTokensManager)
+	return nil, nil
+}
+
+func WireReadOnlyApp(configPath string) (*App, error) {
+	wire.Build(NewReadOnlyApp, LoadConfig, NewAccounts, NewHistory, NewCounterparties, NewAccountTokens, newRPCClient, newEthClient, newTokensDB, newStore, token.NewTokensManager)
 	return nil, nil
 }
@@ -8,6 +8,7 @@ package main
 
 import (
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/andrei-toptal/eth-listener/token"
 )
 
@@ -19,23 +20,62 @@ func WireApp(configPath string) (*App, error) {
 		return nil, err
 	}
 	tokensDB := newTokensDB()
+	store := newStore()
 	accounts := NewAccounts(config)
-	mainTelegram := NewTelegram(config)
-	client, err := newEthClient(config)
+	rpcClient, err := newRPCClient(config)
+	if err != nil {
+		return nil, err
+	}
+	client := newEthClient(rpcClient)
+	tokensManager := token.NewTokensManager(rpcClient, client, tokensDB)
+	history := NewHistory(store)
+	counterparties := NewCounterparties(store, history)
+	accountTokens := NewAccountTokens(store, history)
+	app, err := NewApp(config, tokensDB, store, accounts, client, tokensManager, history, counterparties, accountTokens)
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func WireReadOnlyApp(configPath string) (*App, error) {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	tokensDB := newTokensDB()
+	store := newStore()
+	accounts := NewAccounts(config)
+	rpcClient, err := newRPCClient(config)
+	if err != nil {
+		return nil, err
+	}
+	client := newEthClient(rpcClient)
+	tokensManager := token.NewTokensManager(rpcClient, client, tokensDB)
+	history := NewHistory(store)
+	counterparties := NewCounterparties(store, history)
+	accountTokens := NewAccountTokens(store, history)
+	app, err := NewReadOnlyApp(config, tokensDB, store, accounts, client, tokensManager, history, counterparties, accountTokens)
 	if err != nil {
 		return nil, err
 	}
-	tokensManager := token.NewTokensManager(client, tokensDB)
-	app := NewApp(config, tokensDB, accounts, mainTelegram, client, tokensManager)
 	return app, nil
 }
 
 // wire.go:
 
-func newEthClient(config *Config) (*ethclient.Client, error) {
-	return ethclient.Dial(config.EthUrl)
+func newRPCClient(config *Config) (*rpc.Client, error) {
+	return rpc.Dial(config.EthUrl)
+}
+
+func newEthClient(rpcClient *rpc.Client) *ethclient.Client {
+	return ethclient.NewClient(rpcClient)
 }
 
 func newTokensDB() token.TokensDB {
 	return token.NewTokensDB(TokensDBPath)
 }
+
+func newStore() Store {
+	return NewStore(StoreDBPath)
+}